@@ -10,8 +10,6 @@ import (
 	_ "github.com/StackExchange/blackbox/v2/pkg/vcs/_all"
 )
 
-var dryRun bool
-
 func main() {
 	app := flags()
 	err := app.Run(os.Args)
@@ -4,6 +4,7 @@ package main
 
 import (
 	"fmt"
+	"runtime"
 
 	"github.com/urfave/cli/v2"
 
@@ -20,12 +21,15 @@ func flags() *cli.App {
 	defUmaskS := fmt.Sprintf("%04o", defUmask)
 
 	app.Flags = []cli.Flag{
-		//		&cli.BoolFlag{
-		//			Name:        "dry-run",
-		//			Aliases:     []string{"n"},
-		//			Usage:       "show what would have been done",
-		//			Destination: &dryRun,
-		//		},
+		&cli.StringFlag{
+			Name:    "format",
+			Usage:   "Output format of status, info, admin list, file list, doctor and lint: table, json or plain (or junit, for lint)",
+			EnvVars: []string{"BLACKBOX_FORMAT"},
+		},
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "show what would have been done, but change nothing",
+		},
 		&cli.StringFlag{
 			Name:    "vcs",
 			Usage:   "Use this VCS (GIT, NONE) rather than autodetect",
@@ -60,6 +64,12 @@ func flags() *cli.App {
 			Value:   defUmaskS,
 			EnvVars: []string{"BLACKBOX_UMASK", "DECRYPT_UMASK"},
 		},
+		&cli.IntFlag{
+			Name:    "parallel",
+			Usage:   "How many files to encrypt, decrypt, etc. at once",
+			Value:   runtime.NumCPU(),
+			EnvVars: []string{"BLACKBOX_PARALLEL"},
+		},
 		&cli.BoolFlag{
 			Name:    "debug",
 			Usage:   "Show debug output",
@@ -78,12 +88,24 @@ func flags() *cli.App {
 			Flags: []cli.Flag{
 				&cli.BoolFlag{Name: "all", Usage: "All registered files"},
 				&cli.BoolFlag{Name: "agentcheck", Usage: "Do not check for gpg-agent when using --all"},
+				&cli.BoolFlag{Name: "changed-only", Usage: "Only list files that are new or changed"},
 				&cli.StringFlag{Name: "group", Usage: "Set group ownership"},
+				&cli.BoolFlag{Name: "json", Usage: "Output a JSON summary of new, changed and unchanged files"},
 				&cli.BoolFlag{Name: "overwrite", Usage: "Overwrite plaintext if it exists"},
+				&cli.BoolFlag{Name: "recursive", Usage: "All registered files, in this and nested repos (submodules, etc.)"},
 			},
 			Action: func(c *cli.Context) error { return cmdDecrypt(c) },
 		},
 
+		{
+			Name:  "deploy",
+			Usage: "Decrypt all files, non-interactively, on production hosts (v1's postdeploy)",
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "group", Usage: "Set group ownership (and g+r) of the plaintext"},
+			},
+			Action: func(c *cli.Context) error { return cmdDeploy(c) },
+		},
+
 		{
 			Name:    "encrypt",
 			Aliases: []string{"en", "end"},
@@ -97,16 +119,60 @@ func flags() *cli.App {
 		{
 			Name:    "edit",
 			Aliases: []string{"vi"},
-			Usage:   "Runs $EDITOR on file(s) (decrypt if needed)",
+			Usage:   "Runs $EDITOR on a decrypted temp copy of file(s), re-encrypts if changed",
 			Action:  func(c *cli.Context) error { return cmdEdit(c) },
 		},
 
 		{
-			Name:   "cat",
-			Usage:  "Output plaintext to stderr (decrypt if needed)",
+			Name:      "exec",
+			Usage:     "Run a command with secrets in its environment (decrypted in memory)",
+			ArgsUsage: "-- COMMAND [ARGS...]",
+			Flags: []cli.Flag{
+				&cli.StringSliceFlag{Name: "env-file", Usage: "Set environment variables from this dotenv-style `FILE`"},
+				&cli.StringSliceFlag{Name: "file-as-env", Usage: "Set `NAME` to a /dev/fd path from which the command can read FILE (once)"},
+			},
+			Action: func(c *cli.Context) error { return cmdExec(c) },
+		},
+
+		{
+			Name:  "cat",
+			Usage: "Output plaintext to stderr (decrypt if needed)",
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "rev", Usage: "Output the file as of this revision"},
+			},
 			Action: func(c *cli.Context) error { return cmdCat(c) },
 		},
 
+		{
+			Name:  "log",
+			Usage: "Lists the commits that changed a file",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{Name: "patch", Aliases: []string{"p"}, Usage: "Show decrypted diffs"},
+				&cli.IntFlag{Name: "max-count", Aliases: []string{"n"}, Usage: "Limit the number of commits"},
+			},
+			Action: func(c *cli.Context) error { return cmdLog(c) },
+		},
+
+		{
+			Name:   "whatsnew",
+			Usage:  "Shows the decrypted diff of the last commit of a file",
+			Action: func(c *cli.Context) error { return cmdWhatsnew(c) },
+		},
+
+		{
+			Name:      "get",
+			Usage:     "Output one value of a YAML, JSON or dotenv file (decrypted in memory)",
+			ArgsUsage: "FILE KEY.PATH",
+			Action:    func(c *cli.Context) error { return cmdGet(c) },
+		},
+
+		{
+			Name:      "set",
+			Usage:     "Change one value of a YAML, JSON or dotenv file, and re-encrypt it",
+			ArgsUsage: "FILE KEY.PATH VALUE|-",
+			Action:    func(c *cli.Context) error { return cmdSet(c) },
+		},
+
 		{
 			Name:  "diff",
 			Usage: "Diffs against encrypted version",
@@ -146,6 +212,19 @@ func flags() *cli.App {
 			},
 		},
 
+		{
+			Name:     "audit",
+			Category: "ADMINISTRATIVE",
+			Usage:    "Search for leaked secrets",
+			Subcommands: []*cli.Command{
+				{
+					Name:   "history",
+					Usage:  "Scan the VCS history for plaintext of registered files (JSON report)",
+					Action: func(c *cli.Context) error { return cmdAuditHistory(c) },
+				},
+			},
+		},
+
 		{
 			Name:     "file",
 			Category: "ADMINISTRATIVE",
@@ -164,6 +243,12 @@ func flags() *cli.App {
 					Usage:  "Lists the registered files",
 					Action: func(c *cli.Context) error { return cmdFileList(c) },
 				},
+				{
+					Name:      "mv",
+					Usage:     "Rename a registered file",
+					ArgsUsage: "OLD NEW",
+					Action:    func(c *cli.Context) error { return cmdFileMove(c) },
+				},
 				{
 					Name:   "remove",
 					Usage:  "Deregister file from the system",
@@ -172,6 +257,67 @@ func flags() *cli.App {
 			},
 		},
 
+		{
+			Name:     "filter",
+			Category: "ADMINISTRATIVE",
+			Usage:    "Transparent encryption by the VCS (clean/smudge filter mode)",
+			Subcommands: []*cli.Command{
+				{
+					Name:   "install",
+					Usage:  "Switch to filter mode and/or configure this checkout to use it",
+					Action: func(c *cli.Context) error { return cmdFilterInstall(c) },
+				},
+				{
+					Name:      "clean",
+					Usage:     "Encrypt stdin to stdout (called by the VCS)",
+					ArgsUsage: "[FILE]",
+					Action:    func(c *cli.Context) error { return cmdFilterClean(c) },
+				},
+				{
+					Name:      "smudge",
+					Usage:     "Decrypt stdin to stdout (called by the VCS)",
+					ArgsUsage: "[FILE]",
+					Action:    func(c *cli.Context) error { return cmdFilterSmudge(c) },
+				},
+			},
+		},
+
+		{
+			Name:     "hooks",
+			Category: "ADMINISTRATIVE",
+			Usage:    "Install/run VCS hooks that block committing plaintext",
+			Subcommands: []*cli.Command{
+				{
+					Name:   "install",
+					Usage:  "Installs the pre-commit hook (use with --team for each team)",
+					Action: func(c *cli.Context) error { return cmdHooksInstall(c) },
+				},
+				{
+					Name:   "pre-commit",
+					Usage:  "Check the staged files (called by the pre-commit hook)",
+					Action: func(c *cli.Context) error { return cmdHooksPreCommit(c) },
+				},
+			},
+		},
+
+		{
+			Name:      "merge-driver",
+			Usage:     "Three-way merge registered files (used by git merge), or --install",
+			ArgsUsage: "BASE OURS THEIRS NAME",
+			Category:  "ADMINISTRATIVE",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{Name: "install", Usage: "Configure git merge to use merge-driver for registered files"},
+			},
+			Action: func(c *cli.Context) error { return cmdMergeDriver(c) },
+		},
+
+		{
+			Name:     "doctor",
+			Category: "DEBUG",
+			Usage:    "Check that blackbox can work here (gpg, keys, registry files, VCS), with hints on fixing what can't",
+			Action:   func(c *cli.Context) error { return cmdDoctor(c) },
+		},
+
 		{
 			Name:     "info",
 			Category: "DEBUG",
@@ -184,6 +330,7 @@ func flags() *cli.App {
 			Usage: "Shred files, or --all for all registered files",
 			Flags: []cli.Flag{
 				&cli.BoolFlag{Name: "all", Usage: "All registered files"},
+				&cli.BoolFlag{Name: "recursive", Usage: "All registered files, in this and nested repos (submodules, etc.)"},
 			},
 			Action: func(c *cli.Context) error { return cmdShred(c) },
 		},
@@ -194,24 +341,70 @@ func flags() *cli.App {
 			Usage:    "Print status of files",
 			Flags: []cli.Flag{
 				&cli.BoolFlag{Name: "name-only", Usage: "Show only names of the files"},
+				&cli.BoolFlag{Name: "deep", Usage: "Compare the plaintext with the decrypted file, not timestamps (exit status: 2 modified, 4 stale, 8 undecryptable, 16 missing)"},
 				&cli.BoolFlag{Name: "all", Usage: "All registered files"},
 				&cli.StringFlag{Name: "type", Usage: "only list if status matching this string"},
+				&cli.BoolFlag{Name: "recursive", Usage: "All registered files, in this and nested repos (submodules, etc.)"},
 			},
 			Action: func(c *cli.Context) error { return cmdStatus(c) },
 		},
 
 		{
 			Name:     "reencrypt",
-			Usage:    "Decrypt then re-encrypt files (erases any plaintext)",
+			Usage:    "Re-encrypt files for the current admins (in memory; plaintext is untouched)",
 			Category: "ADMINISTRATIVE",
 			Flags: []cli.Flag{
 				&cli.BoolFlag{Name: "all", Usage: "All registered files"},
-				&cli.BoolFlag{Name: "overwrite", Usage: "Overwrite plaintext if it exists"},
+				// No longer needed, as plaintext is never written.
+				&cli.BoolFlag{Name: "overwrite", Hidden: true},
 				&cli.BoolFlag{Name: "agentcheck", Usage: "Do not check for gpg-agent when using --all"},
+				&cli.BoolFlag{Name: "recursive", Usage: "All registered files, in this and nested repos (submodules, etc.)"},
 			},
 			Action: func(c *cli.Context) error { return cmdReencrypt(c) },
 		},
 
+		{
+			Name:      "textconv",
+			Usage:     "Output a decrypted .gpg file (used by git diff), or --install",
+			ArgsUsage: "FILE.gpg",
+			Category:  "ADMINISTRATIVE",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{Name: "install", Usage: "Configure git diff to use textconv for registered files"},
+			},
+			Action: func(c *cli.Context) error { return cmdTextconv(c) },
+		},
+
+		{
+			Name:     "validate",
+			Category: "ADMINISTRATIVE",
+			Usage:    "Check files with the validators in the config (i.e. in CI)",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{Name: "all", Usage: "All registered files"},
+				&cli.BoolFlag{Name: "recursive", Usage: "All registered files, in this and nested repos (submodules, etc.)"},
+			},
+			Action: func(c *cli.Context) error { return cmdValidate(c) },
+		},
+
+		{
+			Name:     "lint",
+			Category: "ADMINISTRATIVE",
+			Usage:    "Check the repo's invariants without a secret key (i.e. in CI): registry, .gpg files, recipients, tracked plaintexts",
+			Action:   func(c *cli.Context) error { return cmdLint(c) },
+		},
+
+		{
+			Name:     "vcs",
+			Category: "ADMINISTRATIVE",
+			Usage:    "Maintain the VCS configuration (.gitignore, .gitattributes, etc.)",
+			Subcommands: []*cli.Command{
+				{
+					Name:   "sync",
+					Usage:  "Regenerate the blackbox ignores and attributes from the registry",
+					Action: func(c *cli.Context) error { return cmdVcsSync(c) },
+				},
+			},
+		},
+
 		{
 			Name:     "testing_init",
 			Usage:    "For use with integration test",
@@ -4,9 +4,13 @@ package main
 // conflicts and drive to the business logic.
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"os/exec"
+	"strings"
 
 	"github.com/StackExchange/blackbox/v2/pkg/bblog"
 	"github.com/StackExchange/blackbox/v2/pkg/box"
@@ -25,12 +29,52 @@ func allOrSomeFiles(c *cli.Context) error {
 	if c.Bool("all") && c.Args().Present() {
 		return fmt.Errorf("Can not specify filenames and --all")
 	}
-	if (!c.Args().Present()) && (!c.Bool("all")) {
+	if c.Bool("recursive") && c.Args().Present() {
+		return fmt.Errorf("Can not specify filenames and --recursive")
+	}
+	if (!c.Args().Present()) && (!c.Bool("all")) && (!c.Bool("recursive")) {
 		return fmt.Errorf("Must specify at least one file name or --all")
 	}
 	return nil
 }
 
+// forEachBox runs fn on bx and flushes its commits. With --recursive,
+// it does the same for each nested repo, labeling the output with the
+// repo's path (on stderr, to keep stdout for the report). All repos are
+// processed even if some fail.
+func forEachBox(c *cli.Context, bx *box.Box, fn func(bx *box.Box) error) error {
+	if !c.Bool("recursive") {
+		err := fn(bx)
+		if err != nil {
+			return err
+		}
+		return bx.Vcs.FlushCommits()
+	}
+
+	nested, err := bx.Nested()
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, b := range append([]*box.Box{bx}, nested...) {
+		fmt.Fprintf(os.Stderr, "========== REPO: %s\n", b.RepoBaseDir)
+		err := fn(b)
+		if err == nil {
+			err = b.Vcs.FlushCommits()
+		}
+		if err != nil {
+			logErr.Printf("%s: %v", b.RepoBaseDir, err)
+			failed = append(failed, b.RepoBaseDir)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "========== %d repos, %d failed\n", len(nested)+1, len(failed))
+	if len(failed) != 0 {
+		return fmt.Errorf("failed in %d repo(s): %s", len(failed), strings.Join(failed, " "))
+	}
+	return nil
+}
+
 const roError = `This command is disabled due to --config flag being used.
 We can not determine if the flag's value is in or out of the repo, and
 Blackbox can only work on one repo at a time. If the value is inside the
@@ -61,8 +105,20 @@ func cmdAdminList(c *cli.Context) error {
 	if c.Args().Present() {
 		return fmt.Errorf("This command takes zero arguments")
 	}
+	format, err := outputFormat(c, formatPlain)
+	if err != nil {
+		return err
+	}
 	bx := box.NewFromFlags(c)
-	err := bx.AdminList()
+	admins, err := bx.AdminList()
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, a := range admins {
+		rows = append(rows, []string{a.ID})
+	}
+	err = render(format, admins, []string{"Admin"}, rows)
 	if err != nil {
 		return err
 	}
@@ -84,12 +140,20 @@ func cmdAdminRemove(c *cli.Context) error {
 	return bx.Vcs.FlushCommits()
 }
 
+func cmdAuditHistory(c *cli.Context) error {
+	if c.Args().Present() {
+		return fmt.Errorf("This command takes zero arguments")
+	}
+	bx := box.NewFromFlags(c)
+	return bx.AuditHistory()
+}
+
 func cmdCat(c *cli.Context) error {
 	if !c.Args().Present() {
 		return fmt.Errorf("Must specify at least one file name")
 	}
 	bx := box.NewFromFlags(c)
-	err := bx.Cat(c.Args().Slice())
+	err := bx.Cat(c.Args().Slice(), c.String("rev"))
 	if err != nil {
 		return err
 	}
@@ -102,22 +166,55 @@ func cmdDecrypt(c *cli.Context) error {
 	}
 
 	// The default for --agentcheck is off normally, and on when using --all.
-	pauseNeeded := c.Bool("all")
+	pauseNeeded := c.Bool("all") || c.Bool("recursive")
 	// If the user used the flag, abide by it.
 	if c.IsSet("agentcheck") {
 		pauseNeeded = c.Bool("agentcheck")
 	}
 
+	// With --recursive, the --json output is a list of the repos' summaries.
+	summaries := []*box.DecryptSummary{}
 	bx := box.NewFromFlags(c)
-	err := bx.Decrypt(c.Args().Slice(),
-		c.Bool("overwrite"),
-		pauseNeeded,
-		c.String("group"),
-	)
-	if err != nil {
+	err := forEachBox(c, bx, func(bx *box.Box) error {
+		s, err := bx.Decrypt(c.Args().Slice(),
+			c.Bool("overwrite"),
+			pauseNeeded,
+			c.String("group"),
+			c.Bool("changed-only"),
+			c.Bool("json"),
+		)
+		pauseNeeded = false // Only pause for the first repo.
+		if s != nil {
+			if c.Bool("recursive") {
+				s.Repo = bx.RepoBaseDir
+			}
+			summaries = append(summaries, s)
+		}
+		return err
+	})
+
+	if !c.Bool("json") {
 		return err
 	}
-	return bx.Vcs.FlushCommits()
+	var v interface{} = summaries
+	if !c.Bool("recursive") {
+		if len(summaries) == 0 {
+			return err // No file was tried.
+		}
+		v = summaries[0]
+	}
+	if rerr := render(formatJSON, v, nil, nil); rerr != nil {
+		return rerr
+	}
+	return err
+}
+
+func cmdDeploy(c *cli.Context) error {
+	if c.Args().Present() {
+		return fmt.Errorf("No args required")
+	}
+	bx := box.NewFromFlags(c)
+	return bx.Deploy(c.String("group"))
 }
 
 func cmdDiff(c *cli.Context) error {
@@ -132,16 +229,54 @@ func cmdDiff(c *cli.Context) error {
 	return bx.Vcs.FlushCommits()
 }
 
+func cmdDoctor(c *cli.Context) error {
+	if c.Args().Present() {
+		return fmt.Errorf("This command takes zero arguments")
+	}
+	format, err := outputFormat(c, formatPlain)
+	if err != nil {
+		return err
+	}
+	bx := box.NewFromFlags(c)
+	checks := bx.Doctor()
+
+	failed := 0
+	var rows [][]string
+	for _, ch := range checks {
+		result := "PASS"
+		if !ch.OK {
+			result = "FAIL"
+			failed++
+		}
+		rows = append(rows, []string{result, ch.Name, ch.Detail, ch.Hint})
+	}
+	if format == formatPlain {
+		for _, r := range rows {
+			fmt.Printf("%s %s: %s\n", r[0], r[1], r[2])
+			if r[3] != "" {
+				fmt.Printf("     HINT: %s\n", r[3])
+			}
+		}
+	} else if err := render(format, checks, []string{"Result", "Check", "Detail", "Hint"}, rows); err != nil {
+		return err
+	}
+
+	if failed != 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+	return nil
+}
+
 func cmdEdit(c *cli.Context) error {
 	if !c.Args().Present() {
 		return fmt.Errorf("Must specify at least one file name")
 	}
 	bx := box.NewFromFlags(c)
 	err := bx.Edit(c.Args().Slice())
-	if err != nil {
-		return err
+	if ferr := bx.Vcs.FlushCommits(); err == nil {
+		err = ferr
 	}
-	return bx.Vcs.FlushCommits()
+	return err
 }
 
 func cmdEncrypt(c *cli.Context) error {
@@ -156,6 +291,20 @@ func cmdEncrypt(c *cli.Context) error {
 	return bx.Vcs.FlushCommits()
 }
 
+func cmdExec(c *cli.Context) error {
+	if !c.Args().Present() {
+		return fmt.Errorf("Must specify a command")
+	}
+	bx := box.NewFromFlags(c)
+	err := bx.Exec(c.StringSlice("env-file"), c.StringSlice("file-as-env"), c.Args().Slice())
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		// Exit as the command did, without further ado.
+		return cli.Exit("", exitErr.ExitCode())
+	}
+	return err
+}
+
 func cmdFileAdd(c *cli.Context) error {
 	if !c.Args().Present() {
 		return fmt.Errorf("Must specify at least one file name")
@@ -175,8 +324,35 @@ func cmdFileList(c *cli.Context) error {
 	if c.Args().Present() {
 		return fmt.Errorf("This command takes zero arguments")
 	}
+	format, err := outputFormat(c, formatPlain)
+	if err != nil {
+		return err
+	}
+	bx := box.NewFromFlags(c)
+	files, err := bx.FileList()
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, f := range files {
+		rows = append(rows, []string{f.Name})
+	}
+	err = render(format, files, []string{"Name"}, rows)
+	if err != nil {
+		return err
+	}
+	return bx.Vcs.FlushCommits()
+}
+
+func cmdFileMove(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return fmt.Errorf("Must specify exactly two file names (old and new)")
+	}
 	bx := box.NewFromFlags(c)
-	err := bx.FileList()
+	if bx.ConfigRO {
+		return fmt.Errorf(roError)
+	}
+	err := bx.FileMove(c.Args().Get(0), c.Args().Get(1))
 	if err != nil {
 		return err
 	}
@@ -198,12 +374,90 @@ func cmdFileRemove(c *cli.Context) error {
 	return bx.Vcs.FlushCommits()
 }
 
+func cmdFilterClean(c *cli.Context) error {
+	if c.NArg() > 1 {
+		return fmt.Errorf("This command takes zero or one arguments")
+	}
+	bx := box.NewFromFlags(c)
+	return bx.FilterClean(c.Args().First())
+}
+
+func cmdFilterInstall(c *cli.Context) error {
+	if c.Args().Present() {
+		return fmt.Errorf("This command takes zero arguments")
+	}
+	bx := box.NewFromFlags(c)
+	if bx.ConfigRO {
+		return fmt.Errorf(roError)
+	}
+	err := bx.FilterInstall()
+	if err != nil {
+		return err
+	}
+	return bx.Vcs.FlushCommits()
+}
+
+func cmdFilterSmudge(c *cli.Context) error {
+	if c.NArg() > 1 {
+		return fmt.Errorf("This command takes zero or one arguments")
+	}
+	bx := box.NewFromFlags(c)
+	return bx.FilterSmudge(c.Args().First())
+}
+
+func cmdGet(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return fmt.Errorf("Must specify a file name and a key path")
+	}
+	bx := box.NewFromFlags(c)
+	return bx.Get(c.Args().Get(0), c.Args().Get(1))
+}
+
+func cmdHooksInstall(c *cli.Context) error {
+	if c.Args().Present() {
+		return fmt.Errorf("This command takes zero arguments")
+	}
+	bx := box.NewFromFlags(c)
+	return bx.HooksInstall()
+}
+
+func cmdHooksPreCommit(c *cli.Context) error {
+	if c.Args().Present() {
+		return fmt.Errorf("This command takes zero arguments")
+	}
+	bx := box.NewFromFlags(c)
+	return bx.HooksPreCommit()
+}
+
 func cmdInfo(c *cli.Context) error {
 	if c.Args().Present() {
 		return fmt.Errorf("This command takes zero arguments")
 	}
+	format, err := outputFormat(c, formatTable)
+	if err != nil {
+		return err
+	}
 	bx := box.NewFromFlags(c)
-	err := bx.Info()
+	info, err := bx.Info()
+	if err != nil {
+		return err
+	}
+	rows := [][]string{
+		{"Debug", fmt.Sprint(info.Debug)},
+		{"Team", info.Team},
+		{"RepoBaseDir", info.RepoBaseDir},
+		{"ConfigPath", info.ConfigPath},
+		{"Umask", info.Umask},
+		{"Editor", info.Editor},
+		{"Parallel", fmt.Sprint(info.Parallel)},
+		{"DryRun", fmt.Sprint(info.DryRun)},
+		{"Shredder", info.Shredder},
+		{"Admins", fmt.Sprint(info.Admins)},
+		{"Files", fmt.Sprint(info.Files)},
+		{"Vcs", info.Vcs},
+		{"Crypter", info.Crypter},
+	}
+	err = render(format, info, []string{"Setting", "Value"}, rows)
 	if err != nil {
 		return err
 	}
@@ -225,23 +479,128 @@ func cmdInit(c *cli.Context) error {
 	return bx.Vcs.FlushCommits()
 }
 
+func cmdLint(c *cli.Context) error {
+	if c.Args().Present() {
+		return fmt.Errorf("This command takes zero arguments")
+	}
+	format, err := outputFormat(c, formatPlain, formatJUnit)
+	if err != nil {
+		return err
+	}
+	bx := box.NewFromFlags(c)
+	results, err := bx.Lint()
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	var rows [][]string
+	suite := junitTestsuite{Name: "blackbox lint"}
+	for _, r := range results {
+		tc := junitTestcase{Name: r.Name, Classname: "blackbox.lint"}
+		switch {
+		case r.Skipped != "":
+			rows = append(rows, []string{"SKIP", r.Name, r.Skipped})
+			tc.Skipped = &junitMessage{Message: r.Skipped}
+		case len(r.Problems) != 0:
+			failed++
+			for _, p := range r.Problems {
+				rows = append(rows, []string{"FAIL", r.Name, p})
+			}
+			tc.Failure = &junitMessage{
+				Message: fmt.Sprintf("%d problem(s)", len(r.Problems)),
+				Text:    strings.Join(r.Problems, "\n"),
+			}
+		default:
+			rows = append(rows, []string{"PASS", r.Name, ""})
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+	switch format {
+	case formatJUnit:
+		err = renderJUnit(suite)
+	case formatPlain:
+		for _, r := range rows {
+			if r[2] == "" {
+				fmt.Printf("%s %s\n", r[0], r[1])
+			} else {
+				fmt.Printf("%s %s: %s\n", r[0], r[1], r[2])
+			}
+		}
+	default:
+		err = render(format, results, []string{"Result", "Check", "Problem"}, rows)
+	}
+	if err != nil {
+		return err
+	}
+
+	if failed != 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(results))
+	}
+	return nil
+}
+
+func cmdLog(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("Must specify exactly one file name")
+	}
+	bx := box.NewFromFlags(c)
+	return bx.Log(c.Args().First(), c.Bool("patch"), c.Int("max-count"))
+}
+
+func cmdMergeDriver(c *cli.Context) error {
+	bx := box.NewFromFlags(c)
+	if c.Bool("install") {
+		if c.Args().Present() {
+			return fmt.Errorf("Can not specify filenames and --install")
+		}
+		err := bx.MergeDriverInstall()
+		if err != nil {
+			return err
+		}
+		return bx.Vcs.FlushCommits()
+	}
+	if c.NArg() != 4 {
+		return fmt.Errorf("Must specify exactly four file names")
+	}
+	a := c.Args()
+	return bx.MergeDriver(a.Get(0), a.Get(1), a.Get(2), a.Get(3))
+}
+
 func cmdReencrypt(c *cli.Context) error {
 	if err := allOrSomeFiles(c); err != nil {
 		return err
 	}
 
 	// The default for --agentcheck is off normally, and on when using --all.
-	pauseNeeded := c.Bool("all")
+	pauseNeeded := c.Bool("all") || c.Bool("recursive")
 	// If the user used the flag, abide by it.
 	if c.IsSet("agentcheck") {
 		pauseNeeded = c.Bool("agentcheck")
 	}
 
 	bx := box.NewFromFlags(c)
-	err := bx.Reencrypt(c.Args().Slice(),
-		c.Bool("overwrite"),
-		pauseNeeded,
-	)
+	return forEachBox(c, bx, func(bx *box.Box) error {
+		err := bx.Reencrypt(c.Args().Slice(), pauseNeeded)
+		pauseNeeded = false // Only pause for the first repo.
+		return err
+	})
+}
+
+func cmdSet(c *cli.Context) error {
+	if c.NArg() != 3 {
+		return fmt.Errorf("Must specify a file name, a key path and a value (or - to read it from stdin)")
+	}
+	value := c.Args().Get(2)
+	if value == "-" {
+		b, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		value = strings.TrimSuffix(string(b), "\n")
+	}
+	bx := box.NewFromFlags(c)
+	err := bx.Set(c.Args().Get(0), c.Args().Get(1), value)
 	if err != nil {
 		return err
 	}
@@ -253,25 +612,153 @@ func cmdShred(c *cli.Context) error {
 		return err
 	}
 	bx := box.NewFromFlags(c)
-	err := bx.Shred(c.Args().Slice())
-	if err != nil {
-		return err
-	}
-	return bx.Vcs.FlushCommits()
+	return forEachBox(c, bx, func(bx *box.Box) error {
+		return bx.Shred(c.Args().Slice())
+	})
 }
 
 func cmdStatus(c *cli.Context) error {
 	if c.Bool("all") && c.Args().Present() {
 		return fmt.Errorf("Can not specify filenames and --all")
 	}
+	if c.Bool("recursive") && c.Args().Present() {
+		return fmt.Errorf("Can not specify filenames and --recursive")
+	}
+	nameOnly := c.Bool("name-only")
+	if nameOnly && c.String("format") != "" {
+		return fmt.Errorf("Can not specify --name-only and --format")
+	}
+	format, err := outputFormat(c, formatTable)
+	if err != nil {
+		return err
+	}
+
+	// With --recursive, the files of all the repos are in one report.
+	states := []box.FileState{}
+	bx := box.NewFromFlags(c)
+	err = forEachBox(c, bx, func(bx *box.Box) error {
+		s, err := bx.Status(c.Args().Slice(), c.String("type"), c.Bool("deep"))
+		if c.Bool("recursive") {
+			for i := range s {
+				s[i].Repo = bx.RepoBaseDir
+			}
+		}
+		states = append(states, s...)
+		return err
+	})
+
+	if nameOnly {
+		for _, s := range states {
+			if s.Error != "" {
+				fmt.Printf("%s: %s\n", s.Name, s.Error)
+			} else {
+				fmt.Println(s.Name)
+			}
+		}
+		return deepExit(c.Bool("deep"), states, err)
+	}
+
+	header := []string{"Status", "Name"}
+	for _, s := range states {
+		if s.Error != "" {
+			header = append(header, "Error")
+			break
+		}
+	}
+	var rows [][]string
+	for _, s := range states {
+		r := []string{s.Status, s.Name}
+		if len(header) == 3 {
+			r = append(r, s.Error)
+		}
+		rows = append(rows, r)
+	}
+	if rerr := render(format, states, header, rows); rerr != nil {
+		return rerr
+	}
+	return deepExit(c.Bool("deep"), states, err)
+}
+
+// The exit status of "status --deep" has a bit set for each kind of
+// problem found, so that scripts (i.e. a pre-push hook) can tell them
+// apart. 1 is left for other errors.
+var deepExitCodes = map[string]int{
+	"MODIFIED":      2,
+	"STALE":         4,
+	"UNDECRYPTABLE": 8,
+	"GPGMISSING":    16,
+	"BOTHMISSING":   16,
+	"PLAINERROR":    16,
+	"GPGERROR":      16,
+	"NOTREG":        16,
+}
+
+// deepExit returns err or, if deep (--deep), the exit status for states.
+func deepExit(deep bool, states []box.FileState, err error) error {
+	if err != nil || !deep {
+		return err
+	}
+	code := 0
+	for _, s := range states {
+		code |= deepExitCodes[s.Status]
+	}
+	if code != 0 {
+		return cli.Exit("", code)
+	}
+	return nil
+}
+
+func cmdTextconv(c *cli.Context) error {
 	bx := box.NewFromFlags(c)
-	err := bx.Status(c.Args().Slice(), c.Bool("name-only"), c.String("type"))
+	if c.Bool("install") {
+		if c.Args().Present() {
+			return fmt.Errorf("Can not specify filenames and --install")
+		}
+		err := bx.TextconvInstall()
+		if err != nil {
+			return err
+		}
+		return bx.Vcs.FlushCommits()
+	}
+	if c.NArg() != 1 {
+		return fmt.Errorf("Must specify exactly one file name")
+	}
+	return bx.Textconv(c.Args().First())
+}
+
+func cmdValidate(c *cli.Context) error {
+	if err := allOrSomeFiles(c); err != nil {
+		return err
+	}
+	bx := box.NewFromFlags(c)
+	return forEachBox(c, bx, func(bx *box.Box) error {
+		return bx.Validate(c.Args().Slice())
+	})
+}
+
+func cmdVcsSync(c *cli.Context) error {
+	if c.Args().Present() {
+		return fmt.Errorf("No args required")
+	}
+	bx := box.NewFromFlags(c)
+	if bx.ConfigRO {
+		return fmt.Errorf(roError)
+	}
+	err := bx.VcsSync()
 	if err != nil {
 		return err
 	}
 	return bx.Vcs.FlushCommits()
 }
 
+func cmdWhatsnew(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("Must specify exactly one file name")
+	}
+	bx := box.NewFromFlags(c)
+	return bx.Log(c.Args().First(), true, 1)
+}
+
 // These are "secret" commands used by the integration tests.
 
 func testingInit(c *cli.Context) error {
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/StackExchange/blackbox/v2/pkg/box"
+	"github.com/urfave/cli/v2"
+)
+
+func TestDeepExit(t *testing.T) {
+	for i, test := range []struct {
+		deep     bool
+		statuses []string
+		expected int // The exit status.
+	}{
+		{true, nil, 0},
+		{true, []string{"UNCHANGED", "SHREDDED"}, 0},
+		{true, []string{"MODIFIED"}, 2},
+		{true, []string{"STALE"}, 4},
+		{true, []string{"UNDECRYPTABLE"}, 8},
+		{true, []string{"GPGMISSING"}, 16},
+		{true, []string{"BOTHMISSING"}, 16},
+		{true, []string{"PLAINERROR"}, 16},
+		{true, []string{"GPGERROR"}, 16},
+		{true, []string{"NOTREG"}, 16},
+		{true, []string{"MODIFIED", "UNCHANGED", "STALE"}, 6},
+		{true, []string{"MODIFIED", "MODIFIED"}, 2},
+		{true, []string{"STALE", "UNDECRYPTABLE", "GPGMISSING", "MODIFIED"}, 30},
+		{false, []string{"MODIFIED", "STALE"}, 0},
+	} {
+		var states []box.FileState
+		for _, s := range test.statuses {
+			states = append(states, box.FileState{Status: s, Name: "x"})
+		}
+		g := 0
+		if err := deepExit(test.deep, states, nil); err != nil {
+			var ec cli.ExitCoder
+			if !errors.As(err, &ec) {
+				t.Fatalf("%03d: FAILED %q: not an exit status: %v", i, test.statuses, err)
+			}
+			g = ec.ExitCode()
+		}
+		if g != test.expected {
+			t.Errorf("%03d: FAILED %q: got=%d wanted=%d", i, test.statuses, g, test.expected)
+		}
+	}
+
+	// Errors take precedence.
+	want := errors.New("boom")
+	if err := deepExit(true, []box.FileState{{Status: "MODIFIED"}}, want); err != want {
+		t.Errorf("FAILED error: got=%v wanted=%v", err, want)
+	}
+}
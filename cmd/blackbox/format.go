@@ -0,0 +1,113 @@
+package main
+
+// Rendering of the results of the commands that report (status, info,
+// admin list, file list, doctor, lint) in the --format chosen. The JSON schemas are
+// documented in docs/output-formats.md. Don't change them lightly:
+// other tools depend on them.
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/urfave/cli/v2"
+)
+
+// The output formats.
+const (
+	formatTable = "table" // An ASCII table, with a header.
+	formatJSON  = "json"  // See docs/output-formats.md.
+	formatPlain = "plain" // One line per row, the columns separated by tabs.
+	formatJUnit = "junit" // JUnit XML, which CI systems understand. Only for lint.
+)
+
+// outputFormat returns the --format, or def if it wasn't set. more are
+// the formats other than table, json and plain that the command supports.
+func outputFormat(c *cli.Context, def string, more ...string) (string, error) {
+	f := c.String("format")
+	if f == "" {
+		return def, nil
+	}
+	known := append([]string{formatTable, formatJSON, formatPlain}, more...)
+	for _, k := range known {
+		if f == k {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("unknown --format %q (expected %s or %s)", f,
+		strings.Join(known[:len(known)-1], ", "), known[len(known)-1])
+}
+
+// render prints v as JSON, or header and rows as a table or as plain
+// text (which has no header).
+func render(format string, v interface{}, header []string, rows [][]string) error {
+	switch format {
+	case formatJSON:
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+	case formatPlain:
+		for _, r := range rows {
+			fmt.Println(strings.Join(r, "\t"))
+		}
+	default:
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetAutoWrapText(false)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.SetHeader(header)
+		table.AppendBulk(rows)
+		table.Render()
+	}
+	return nil
+}
+
+// The JUnit XML report format, as read by Jenkins, GitLab, etc.
+type junitTestsuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestsuite `xml:"testsuite"`
+}
+
+type junitTestsuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Cases    []junitTestcase `xml:"testcase"`
+}
+
+type junitTestcase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// renderJUnit prints suite as a JUnit XML report. The counts are filled in.
+func renderJUnit(suite junitTestsuite) error {
+	suite.Tests, suite.Failures, suite.Skipped = len(suite.Cases), 0, 0
+	for _, tc := range suite.Cases {
+		if tc.Failure != nil {
+			suite.Failures++
+		}
+		if tc.Skipped != nil {
+			suite.Skipped++
+		}
+	}
+	b, err := xml.MarshalIndent(junitTestsuites{Suites: []junitTestsuite{suite}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Print(xml.Header)
+	fmt.Println(string(b))
+	return nil
+}
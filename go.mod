@@ -3,9 +3,11 @@ module github.com/StackExchange/blackbox/v2
 go 1.14
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/andreyvit/diff v0.0.0-20170406064948-c7f18ee00883
 	github.com/mattn/go-runewidth v0.0.9 // indirect
 	github.com/olekukonko/tablewriter v0.0.4
 	github.com/sergi/go-diff v1.2.0 // indirect
 	github.com/urfave/cli/v2 v2.2.0
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/StackExchange/blackbox/v2/pkg/bblog"
@@ -339,5 +341,113 @@ func TestEvilFilenames(t *testing.T) {
 	}
 }
 
+// TestHistory tests the commands that read the VCS history, and
+// --recursive with nested repos.
+func TestHistory(t *testing.T) {
+	if !*longTests {
+		return
+	}
+	compile(t)
+	setup(t)
+	makeHomeDir(t, "History")
+
+	runBB(t, "testing_init") // Runs "git init" or equiv
+	assertFileExists(t, ".git")
+	runBB(t, "init", "yes") // Creates .blackbox or equiv
+
+	phase("Alice creates a GPG key")
+	gpgdir := makeAdmin(t, "alice", "Alice Example", "alice@example.com")
+	become(t, "alice")
+	runBB(t, "admin", "add", "alice@example.com", gpgdir)
+
+	phase("Alice commits two versions of foo.txt")
+	plainOne := "I am the first foo.txt!\n"
+	plainTwo := "I am the second foo.txt!\n"
+	makeFile(t, "foo.txt", plainOne)
+	runBB(t, "file", "add", "--shred", "foo.txt")
+	runGit(t, "commit", "-q", "-m", "first foo")
+	makeFile(t, "foo.txt", plainTwo)
+	runBB(t, "encrypt", "--shred", "foo.txt")
+	runGit(t, "commit", "-q", "-a", "-m", "second foo")
+	if out := outputBB(t, false, "cat", "--rev", "HEAD~1", "foo.txt"); out != plainOne {
+		t.Errorf("cat --rev HEAD~1 foo.txt: got=%q wanted=%q", out, plainOne)
+	}
+	if out := outputBB(t, false, "cat", "--rev", "HEAD", "foo.txt"); out != plainTwo {
+		t.Errorf("cat --rev HEAD foo.txt: got=%q wanted=%q", out, plainTwo)
+	}
+
+	phase("Alice reads the history of foo.txt")
+	out := outputBB(t, false, "log", "foo.txt")
+	assertContains(t, out, "second foo", "first foo")
+	out = outputBB(t, false, "log", "-n", "1", "foo.txt")
+	if strings.Contains(out, "first foo") {
+		t.Errorf("log -n 1 shows more than one commit:\n%s", out)
+	}
+	out = outputBB(t, false, "log", "--patch", "foo.txt")
+	assertContains(t, out, "-"+plainOne, "+"+plainTwo)
+
+	phase("Alice audits the history")
+	out = outputBB(t, false, "audit", "history")
+	if strings.TrimSpace(out) != "[]" {
+		t.Errorf("audit history found leaks in a clean history:\n%s", out)
+	}
+	makeFile(t, "copy.txt", plainTwo)
+	runGit(t, "add", "copy.txt")
+	runGit(t, "commit", "-q", "-m", "leak foo")
+	out = outputBB(t, true, "audit", "history")
+	assertContains(t, out, `"path": "copy.txt"`, `"reason": "content"`, `"subject": "leak foo"`)
+
+	phase("Alice creates a repo within the repo")
+	runBB(t, "shred", "--all")
+	if err := os.Mkdir("inner", 0o770); err != nil {
+		t.Fatal(err)
+	}
+	olddir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir("inner"); err != nil {
+		t.Fatal(err)
+	}
+	runBB(t, "testing_init")
+	become(t, "alice")
+	runBB(t, "init", "yes")
+	runBB(t, "admin", "add", "alice@example.com", gpgdir)
+	makeFile(t, "baz.txt", plainOne)
+	runBB(t, "file", "add", "--shred", "baz.txt")
+	runGit(t, "commit", "-q", "-m", "first baz")
+	if err := os.Chdir(olddir); err != nil {
+		t.Fatal(err)
+	}
+
+	phase("Alice decrypts the nested repo")
+	runBB(t, "decrypt", "--recursive")
+	assertFileContents(t, "foo.txt", plainTwo)
+	assertFileContents(t, "inner/baz.txt", plainOne)
+	runBB(t, "shred", "--recursive")
+	assertFileMissing(t, "foo.txt")
+	assertFileMissing(t, "inner/baz.txt")
+
+	phase("Alice makes the nested repo a submodule")
+	runGit(t, "submodule", "add", "-q", "./inner", "inner")
+	runGit(t, "commit", "-q", "-m", "add inner")
+	runBB(t, "decrypt", "--recursive")
+	assertFileContents(t, "inner/baz.txt", plainOne)
+
+	phase("Alice gets one report for all the repos")
+	out = outputBB(t, false, "--format", "json", "status", "--recursive")
+	var states []map[string]string
+	if err := json.Unmarshal([]byte(out), &states); err != nil || len(states) != 2 {
+		t.Errorf("status --recursive: want one list of 2 files, got %v:\n%s", err, out)
+	}
+	assertContains(t, out, `"repo": "inner"`)
+	out = outputBB(t, false, "decrypt", "--recursive", "--overwrite", "--json")
+	var summaries []map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &summaries); err != nil || len(summaries) != 2 {
+		t.Errorf("decrypt --recursive --json: want one list of 2 repos, got %v:\n%s", err, out)
+	}
+	assertContains(t, out, `"repo": "inner"`)
+}
+
 // More tests to implement.
 // 1. Verify that the --gid works (blackbox decrypt --gid)
@@ -256,6 +256,49 @@ func invalidArgs(t *testing.T, args ...string) {
 	logDebug.Printf("^^^^ (correct error received): err=%q\n", err)
 }
 
+// outputBB runs blackbox with args and returns its stdout. Error if
+// wantErr isn't whether it fails.
+func outputBB(t *testing.T, wantErr bool, args ...string) string {
+	t.Helper()
+
+	logDebug.Printf("outputBB(%q)\n", args)
+	cmd := exec.Command(PathToBlackBox(), args...)
+	cmd.Stdin = nil
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if (err != nil) != wantErr {
+		t.Fatal(fmt.Errorf("outputBB(%q): wantErr=%v err=%v", args, wantErr, err))
+	}
+	return string(out)
+}
+
+// assertContains is an error if output doesn't contain each of wants.
+func assertContains(t *testing.T, output string, wants ...string) {
+	t.Helper()
+
+	for _, w := range wants {
+		if !strings.Contains(output, w) {
+			t.Errorf("output does not contain %q:\n%s", w, output)
+		}
+	}
+}
+
+// runGit runs git in the cwd (the blackbox commands only suggest commits).
+func runGit(t *testing.T, args ...string) {
+	t.Helper()
+
+	logDebug.Printf("runGit(%q)\n", args)
+	cmd := exec.Command("git", args...)
+	cmd.Stdin = nil
+	if *verbose {
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+	}
+	if err := cmd.Run(); err != nil {
+		t.Fatal(fmt.Errorf("runGit(%q): %w", args, err))
+	}
+}
+
 // TestAliceAndBob's helpers.
 
 func setupUser(t *testing.T, user, passphrase string) {
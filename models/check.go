@@ -0,0 +1,9 @@
+package models
+
+// Check is the result of one of the checks made by "blackbox doctor".
+type Check struct {
+	Name   string `json:"name"`           // What was checked (i.e. "gpg-agent").
+	OK     bool   `json:"ok"`             // Whether it passed.
+	Detail string `json:"detail"`         // What was found.
+	Hint   string `json:"hint,omitempty"` // How to fix it, if it failed.
+}
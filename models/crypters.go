@@ -8,8 +8,20 @@ type Crypter interface {
 	Decrypt(filename string, umask int, overwrite bool) error
 	// Encrypt name, overwriting name+".gpg"
 	Encrypt(filename string, umask int, receivers []string) (string, error)
+	// EncryptBytes encrypts data for receivers.
+	EncryptBytes(data []byte, receivers []string) ([]byte, error)
 	// Cat outputs a file, unencrypting if needed.
 	Cat(filename string) ([]byte, error)
+	// DecryptBytes decrypts data that was produced by Encrypt.
+	DecryptBytes(data []byte) ([]byte, error)
+	// IsEncrypted returns true if data looks like the output of Encrypt.
+	IsEncrypted(data []byte) bool
+	// Recipients lists the IDs of the keys that name+".gpg" is encrypted to. No secret key is needed.
+	Recipients(filename string) ([]string, error)
+	// KeyIDs returns the IDs of the keys of each of admins (that has any) in the repo's keyring in keyringdir.
+	KeyIDs(keyringdir string, admins []string) (map[string][]string, error)
 	// AddNewKey extracts keyname from sourcedir's GnuPG chain to destdir keychain.
 	AddNewKey(keyname, repobasename, sourcedir, destdir string) ([]string, error)
+	// Doctor checks that the crypto software works, that one of admins can decrypt, and that the repo's keyring in keyringdir ("" if none) is readable.
+	Doctor(keyringdir string, admins []string) []Check
 }
@@ -0,0 +1,21 @@
+package models
+
+// Commit describes one commit in the VCS history.
+type Commit struct {
+	ID      string // VCS-specific commit ID.
+	Author  string
+	Date    string // RFC 3339.
+	Subject string
+}
+
+// TreeEntry describes a file as it exists in one commit.
+type TreeEntry struct {
+	Name string // Relative to the repo base.
+	Hash string // VCS-specific content hash. See Vcs.HashContent.
+}
+
+// FileVersion describes a commit that changed a file.
+type FileVersion struct {
+	Commit
+	Name string // The file's name in that commit, relative to the repo base.
+}
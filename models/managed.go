@@ -0,0 +1,17 @@
+package models
+
+// Managed is the part of the VCS configuration that blackbox maintains
+// (i.e. a block in .gitignore and .gitattributes). It is generated from
+// the registry and replaced as a whole, never edited.
+type Managed struct {
+	Block          string      // Name of the block. Each team has its own.
+	IgnoreAnywhere []string    // Files to ignore in any directory.
+	Ignore         []string    // Files to ignore, relative to the repo base.
+	Attributes     []Attribute // Attributes of files.
+}
+
+// Attribute sets VCS attributes of a file.
+type Attribute struct {
+	Name  string   // Relative to the repo base.
+	Attrs []string // i.e. "diff=blackbox"
+}
@@ -8,13 +8,49 @@ type Vcs interface {
 	Name() string
 	// Discover returns true if we are a repo of this type; along with the Abs path to the repo root (or "" if we don't know).
 	Discover() (bool, string)
+	// SetDryRun makes the methods that would change files or settings only print what they would do.
+	SetDryRun(dryRun bool)
 
-	// SetFileTypeUnix informs the VCS that files should maintain unix-style line endings.
-	SetFileTypeUnix(repobasedir string, files ...string) error
-	// IgnoreAnywhere tells the VCS to ignore these files anywhere in the repo.
-	IgnoreAnywhere(repobasedir string, files []string) error
-	// IgnoreAnywhere tells the VCS to ignore these files, rooted in the base of the repo.
-	IgnoreFiles(repobasedir string, files []string) error
+	// SetManaged replaces the ignores and attributes that blackbox maintains (i.e. a block in .gitignore and .gitattributes).
+	SetManaged(repobasedir string, m Managed) error
+	// SetDiffDriver defines a driver that displays diffs of files using the text command outputs (i.e. git's textconv).
+	SetDiffDriver(repobasedir string, driver string, command string) error
+	// SetFilterDriver defines a driver that runs files through clean (on checkin) and smudge (on checkout) commands.
+	SetFilterDriver(repobasedir string, driver string, clean string, smudge string) error
+	// SetMergeDriver defines a driver that merges files using command (i.e. a git merge driver).
+	SetMergeDriver(repobasedir string, driver string, command string) error
+	// Remove deletes files and tells the VCS to stop tracking them.
+	Remove(repobasedir string, names []string) error
+	// Rename moves a file, telling the VCS so that its history follows it.
+	Rename(repobasedir string, oldname, newname string) error
+
+	// NestedRepos lists the repos nested in this one (submodules, etc.) and its other worktrees, relative to repobasedir.
+	NestedRepos(repobasedir string) ([]string, error)
+
+	// FileHistory reports whether the VCS tracks a file and lists the commits (in any branch) that touched it.
+	FileHistory(repobasedir string, name string) (tracked bool, commits []string, err error)
+	// TrackedFiles lists the files (relative to repobasedir) that the VCS tracks, including those staged to be added.
+	TrackedFiles(repobasedir string) ([]string, error)
+	// NeedsUntrack queues up removing files from the VCS, but not from disk, for the queued commits.
+	NeedsUntrack(message string, repobasedir string, names []string)
+	// Ignored returns the names (relative to repobasedir) that the VCS ignores (i.e. .gitignore), tracked or not.
+	Ignored(repobasedir string, names []string) ([]string, error)
+
+	// WalkHistory calls fn for every commit reachable from any branch or tag, with the files that commit added or changed.
+	WalkHistory(repobasedir string, fn func(c Commit, files []TreeEntry) error) error
+	// HashContent returns the hash the VCS would give a file containing data (as in TreeEntry.Hash).
+	HashContent(repobasedir string, data []byte) (string, error)
+	// FileLog lists the commits that changed a file, newest first, following renames.
+	FileLog(repobasedir string, name string) ([]FileVersion, error)
+	// CatRevision returns the contents of a file as of a revision.
+	CatRevision(repobasedir string, rev string, name string) ([]byte, error)
+
+	// StagedFiles lists the files (relative to repobasedir) that will be added or changed by the next commit.
+	StagedFiles(repobasedir string) ([]string, error)
+	// CatStaged returns the contents of a file as it will be committed.
+	CatStaged(repobasedir string, name string) ([]byte, error)
+	// InstallPreCommitHook adds command to the VCS's pre-commit hook, keeping any existing hook.
+	InstallPreCommitHook(repobasedir string, command string) error
 
 	// CommitTitle sets the title of the next commit.
 	CommitTitle(title string)
@@ -0,0 +1,9 @@
+package bbutil
+
+import "fmt"
+
+// DryRunf reports something that would have been done, if not for
+// --dry-run. The format is "would ..." (i.e. "would write %q").
+func DryRunf(format string, args ...interface{}) {
+	fmt.Printf("DRY-RUN: "+format+"\n", args...)
+}
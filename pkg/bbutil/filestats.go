@@ -128,3 +128,28 @@ func FindDirInParent(target string) (string, error) {
 	}
 	return "", fmt.Errorf("Not found")
 }
+
+// WriteFileMode writes data to filename, which is left with exactly the
+// permissions perm: the umask is not applied. Unlike changing the umask,
+// this is safe to do in several goroutines at once. If exclusive is set,
+// it fails if filename exists.
+func WriteFileMode(filename string, data []byte, perm os.FileMode, exclusive bool) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if exclusive {
+		flags |= os.O_EXCL
+	}
+	// Create it with no more access than needed until the Chmod.
+	f, err := os.OpenFile(filename, flags, 0o600&perm)
+	if err != nil {
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
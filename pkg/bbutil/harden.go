@@ -0,0 +1,43 @@
+package bbutil
+
+import (
+	"os"
+	"os/exec"
+)
+
+// safePath is put in front of the PATH by Harden, as v1's postdeploy did.
+const safePath = "/usr/bin:/bin"
+
+// keepEnv are the environment variables that commands still get after
+// Harden. GnuPG needs them to find its keys and agent.
+var keepEnv = []string{"HOME", "USER", "LOGNAME", "GNUPGHOME", "GPG_AGENT_INFO", "TMPDIR"}
+
+// hardened is set by Harden.
+var hardened bool
+
+// Harden makes the commands run from now on (by the RunBash functions)
+// find /usr/bin and /bin first, get only a minimal environment, and read
+// stdin from /dev/null, so that nothing waits for input. It is for
+// unattended runs on production hosts (blackbox deploy).
+func Harden() {
+	os.Setenv("PATH", safePath+":"+os.Getenv("PATH")) // For exec.LookPath.
+	hardened = true
+}
+
+// newCmd returns an exec.Cmd that runs command. It reads our stdin,
+// unless Harden was called.
+func newCmd(command string, args ...string) *exec.Cmd {
+	cmd := exec.Command(command, args...)
+	if !hardened {
+		cmd.Stdin = os.Stdin
+		return cmd
+	}
+	// A nil Stdin is /dev/null.
+	cmd.Env = []string{"PATH=" + os.Getenv("PATH")}
+	for _, k := range keepEnv {
+		if v, ok := os.LookupEnv(k); ok {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+	}
+	return cmd
+}
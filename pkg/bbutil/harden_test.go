@@ -0,0 +1,53 @@
+package bbutil
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHarden(t *testing.T) {
+	oldPath := os.Getenv("PATH")
+	defer func() {
+		os.Setenv("PATH", oldPath)
+		os.Unsetenv("BB_SECRET_TEST")
+		hardened = false
+	}()
+	os.Setenv("BB_SECRET_TEST", "leaked")
+
+	Harden()
+	out, err := RunBashOutput("env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		names = append(names, strings.SplitN(line, "=", 2)[0])
+		if strings.HasPrefix(line, "PATH=") && !strings.HasPrefix(line, "PATH="+safePath+":") {
+			t.Errorf("FAILED: %q does not start with %q", line, safePath)
+		}
+	}
+	for _, n := range names {
+		if n != "PATH" && n != "PWD" && !contains(keepEnv, n) {
+			t.Errorf("FAILED: %q was passed (env=%v)", n, names)
+		}
+	}
+	if os.Getenv("HOME") != "" && !contains(names, "HOME") {
+		t.Errorf("FAILED: HOME was not passed (env=%v)", names)
+	}
+
+	// stdin is /dev/null, not ours.
+	out, err = RunBashOutput("cat")
+	if err != nil || out != "" {
+		t.Errorf("FAILED: cat read %q (err=%v)", out, err)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package bbutil
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// Parallel runs job(0) ... job(n-1), at most workers at a time. Each job
+// writes its output to out rather than to stdout. The outputs are copied
+// to w in order (job 0's first), each as soon as the jobs before it are
+// done, so that the output is the same as if the jobs were run one by
+// one. The jobs' errors are returned, in order (nil if a job succeeded).
+// With one worker, the jobs are simply run in turn, writing to w.
+func Parallel(workers, n int, w io.Writer, job func(i int, out io.Writer) error) []error {
+	errs := make([]error, n)
+	if workers <= 1 {
+		for i := range errs {
+			errs[i] = job(i, w)
+		}
+		return errs
+	}
+	outs := make([]bytes.Buffer, n)
+	done := make([]chan struct{}, n)
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for k := 0; k < workers && k < n; k++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				errs[i] = job(i, &outs[i])
+				close(done[i])
+			}
+		}()
+	}
+	go func() {
+		for i := 0; i < n; i++ {
+			jobs <- i
+		}
+		close(jobs)
+	}()
+
+	for i := 0; i < n; i++ {
+		<-done[i]
+		w.Write(outs[i].Bytes())
+	}
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,50 @@
+package bbutil
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParallel(t *testing.T) {
+	for _, workers := range []int{0, 1, 3, 100} {
+		var running, most int32
+		var out bytes.Buffer
+		errs := Parallel(workers, 10, &out, func(i int, w io.Writer) error {
+			r := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				m := atomic.LoadInt32(&most)
+				if r <= m || atomic.CompareAndSwapInt32(&most, m, r) {
+					break
+				}
+			}
+			// Later jobs finish first.
+			time.Sleep(time.Duration(10-i) * time.Millisecond)
+			fmt.Fprintf(w, "%d ", i)
+			if i%4 == 0 {
+				return fmt.Errorf("job %d", i)
+			}
+			return nil
+		})
+
+		if g := out.String(); g != "0 1 2 3 4 5 6 7 8 9 " {
+			t.Errorf("workers=%d: output is out of order: %q", workers, g)
+		}
+		limit := int32(workers)
+		if limit < 1 {
+			limit = 1
+		}
+		if most > limit {
+			t.Errorf("workers=%d: %d jobs ran at once", workers, most)
+		}
+		for i, err := range errs {
+			if (err != nil) != (i%4 == 0) {
+				t.Errorf("workers=%d: job %d: unexpected error %v", workers, i, err)
+			}
+		}
+	}
+}
@@ -5,13 +5,11 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 )
 
 // RunBash runs a Bash command.
 func RunBash(command string, args ...string) error {
-	cmd := exec.Command(command, args...)
-	cmd.Stdin = os.Stdin
+	cmd := newCmd(command, args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	err := cmd.Start()
@@ -27,8 +25,7 @@ func RunBash(command string, args ...string) error {
 
 // RunBashOutput runs a Bash command, captures output.
 func RunBashOutput(command string, args ...string) (string, error) {
-	cmd := exec.Command(command, args...)
-	cmd.Stdin = os.Stdin
+	cmd := newCmd(command, args...)
 	cmd.Stderr = os.Stderr
 	out, err := cmd.Output()
 	if err != nil {
@@ -39,8 +36,7 @@ func RunBashOutput(command string, args ...string) (string, error) {
 
 // RunBashOutputSilent runs a Bash command, captures output, discards stderr.
 func RunBashOutputSilent(command string, args ...string) (string, error) {
-	cmd := exec.Command(command, args...)
-	cmd.Stdin = os.Stdin
+	cmd := newCmd(command, args...)
 	// Leave cmd.Stderr unmodified and stderr is discarded.
 	out, err := cmd.Output()
 	if err != nil {
@@ -52,7 +48,7 @@ func RunBashOutputSilent(command string, args ...string) (string, error) {
 // RunBashInput runs a Bash command, sends input on stdin.
 func RunBashInput(input string, command string, args ...string) error {
 
-	cmd := exec.Command(command, args...)
+	cmd := newCmd(command, args...)
 	cmd.Stdin = bytes.NewBuffer([]byte(input))
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -66,7 +62,7 @@ func RunBashInput(input string, command string, args ...string) error {
 // RunBashInputOutput runs a Bash command, sends input on stdin.
 func RunBashInputOutput(input []byte, command string, args ...string) ([]byte, error) {
 
-	cmd := exec.Command(command, args...)
+	cmd := newCmd(command, args...)
 	cmd.Stdin = bytes.NewBuffer(input)
 	cmd.Stderr = os.Stderr
 	out, err := cmd.Output()
@@ -0,0 +1,62 @@
+package bbutil
+
+import "fmt"
+
+// ShellWords splits s into words the way a POSIX shell would, without
+// doing any expansion: "code --wait" becomes ["code", "--wait"] and
+// "'/Applications/My Editor' -w" becomes ["/Applications/My Editor", "-w"].
+func ShellWords(s string) ([]string, error) {
+	var words []string
+	var word []rune
+	inWord := false
+	var quote rune // The quote we are inside of, or 0.
+	escaped := false
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			// Inside double quotes, a backslash only escapes some chars.
+			if quote == '"' && r != '"' && r != '\\' && r != '$' && r != '`' {
+				word = append(word, '\\')
+			}
+			if r != '\n' { // Backslash-newline is a line continuation.
+				word = append(word, r)
+			}
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word = append(word, r)
+			}
+		case r == '\\':
+			escaped = true
+			inWord = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				word = append(word, r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, string(word))
+				word = word[:0]
+				inWord = false
+			}
+		default:
+			word = append(word, r)
+			inWord = true
+		}
+	}
+	if escaped || quote != 0 {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", s)
+	}
+	if inWord {
+		words = append(words, string(word))
+	}
+	return words, nil
+}
@@ -0,0 +1,41 @@
+package bbutil
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestShellWords(t *testing.T) {
+	for i, test := range []struct {
+		data     string
+		expected []string
+	}{
+		{"", nil},
+		{"  ", nil},
+		{"vi", []string{"vi"}},
+		{"code --wait", []string{"code", "--wait"}},
+		{"  emacs  -nw\t", []string{"emacs", "-nw"}},
+		{`'/Apps/My Editor' -w`, []string{"/Apps/My Editor", "-w"}},
+		{`"/Apps/My Editor" -w`, []string{"/Apps/My Editor", "-w"}},
+		{`/Apps/My\ Editor`, []string{"/Apps/My Editor"}},
+		{`a"b c"d`, []string{"ab cd"}},
+		{`'' x`, []string{"", "x"}},
+		{`"a\"b\c"`, []string{`a"b\c`}},
+		{`'a\b'`, []string{`a\b`}},
+	} {
+		g, err := ShellWords(test.data)
+		if err != nil {
+			t.Errorf("%03d: data=%q error: %v", i, test.data, err)
+			continue
+		}
+		if !reflect.DeepEqual(g, test.expected) {
+			t.Errorf("%03d: data=%q got=%q wanted=%q", i, test.data, g, test.expected)
+		}
+	}
+
+	for i, data := range []string{`'x`, `"x`, `x\`} {
+		if _, err := ShellWords(data); err == nil {
+			t.Errorf("%03d: data=%q expected an error", i, data)
+		}
+	}
+}
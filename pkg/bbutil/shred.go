@@ -7,6 +7,7 @@ package bbutil
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -84,12 +85,10 @@ func shredFile(filename string) error {
 	return nil
 }
 
-// ShredFiles securely erases a list of files.
-func ShredFiles(names []string) error {
-
-	// TODO(tlim) DO the shredding in parallel like in v1.
-
-	var eerr error
+// ShredFiles securely erases a list of files, at most parallel at a time.
+// With dryRun, it only lists them.
+func ShredFiles(names []string, parallel int, dryRun bool) error {
+	var todo []string
 	for _, n := range names {
 		_, err := os.Stat(n)
 		if err != nil {
@@ -98,11 +97,25 @@ func ShredFiles(names []string) error {
 				continue
 			}
 		}
-		fmt.Printf("========== SHREDDING: %q\n", n)
-		e := shredFile(n)
+		if dryRun {
+			DryRunf("would shred %q", n)
+			continue
+		}
+		todo = append(todo, n)
+	}
+
+	var eerr error
+	errs := Parallel(parallel, len(todo), os.Stdout, func(i int, out io.Writer) error {
+		fmt.Fprintf(out, "========== SHREDDING: %q\n", todo[i])
+		e := shredFile(todo[i])
+		if e != nil {
+			fmt.Fprintf(out, "ERROR: %v\n", e)
+		}
+		return e
+	})
+	for _, e := range errs {
 		if e != nil {
 			eerr = e
-			fmt.Printf("ERROR: %v\n", e)
 		}
 	}
 	return eerr
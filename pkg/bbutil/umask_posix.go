@@ -7,6 +7,9 @@ import "syscall"
 
 // Umask is a no-op on Windows, and calls syscall.Umask on all other
 // systems. On Windows it returns 0, which is a decoy.
+//
+// The umask is process-wide. Don't change it while other goroutines may
+// be creating files; use WriteFileMode to set permissions instead.
 func Umask(mask int) int {
 	return syscall.Umask(mask)
 }
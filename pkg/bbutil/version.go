@@ -0,0 +1,31 @@
+package bbutil
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var versionRe = regexp.MustCompile(`\d+(\.\d+)+`)
+
+// VersionAtLeast finds the first version number (i.e. "2.2.27") in s,
+// which is usually the output of "command --version", and reports
+// whether it is at least min. The version is "" if there is none.
+func VersionAtLeast(s, min string) (string, bool) {
+	v := versionRe.FindString(s)
+	if v == "" {
+		return "", false
+	}
+	have, want := strings.Split(v, "."), strings.Split(min, ".")
+	for i := range want {
+		var h int
+		if i < len(have) {
+			h, _ = strconv.Atoi(have[i])
+		}
+		w, _ := strconv.Atoi(want[i])
+		if h != w {
+			return v, h > w
+		}
+	}
+	return v, true
+}
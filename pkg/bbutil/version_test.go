@@ -0,0 +1,25 @@
+package bbutil
+
+import "testing"
+
+func TestVersionAtLeast(t *testing.T) {
+	for i, test := range []struct {
+		s, min   string
+		version  string
+		expected bool
+	}{
+		{"gpg (GnuPG) 2.2.27\nlibgcrypt 1.8.8\n", "2.1.0", "2.2.27", true},
+		{"gpg-agent (GnuPG) 2.1.0\n", "2.1.0", "2.1.0", true},
+		{"gpg-agent (GnuPG) 2.0.30\n", "2.1.0", "2.0.30", false},
+		{"gpg (GnuPG) 1.4.23\n", "2.1.0", "1.4.23", false},
+		{"gpg (GnuPG) 2.10\n", "2.9.1", "2.10", true},
+		{"gpg (GnuPG) 2.1\n", "2.1.0", "2.1", true},
+		{"no version here\n", "2.1.0", "", false},
+	} {
+		v, ok := VersionAtLeast(test.s, test.min)
+		if v != test.version || ok != test.expected {
+			t.Errorf("%03d: %q >= %q: got (%q, %v), expected (%q, %v)",
+				i, test.s, test.min, v, ok, test.version, test.expected)
+		}
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/StackExchange/blackbox/v2/pkg/bblog"
 	"github.com/StackExchange/blackbox/v2/pkg/bbutil"
 	"github.com/StackExchange/blackbox/v2/pkg/crypters"
+	"github.com/StackExchange/blackbox/v2/pkg/makesafe"
 	"github.com/StackExchange/blackbox/v2/pkg/vcs"
 	"github.com/urfave/cli/v2"
 )
@@ -28,12 +29,15 @@ type Box struct {
 	ConfigPath  string // Abs or Rel path to the .blackbox (or whatever) directory.
 	ConfigRO    bool   // True if we should not try to change files in ConfigPath.
 	// Settings:
-	Umask  int    // umask to set when decrypting
-	Editor string // Editor to call
-	Debug  bool   // Are we in debug logging mode?
+	Umask    int    // umask to set when decrypting
+	Editor   string // Editor to call
+	Debug    bool   // Are we in debug logging mode?
+	Parallel int    // How many files to encrypt/decrypt/etc. at once.
+	DryRun   bool   // Only say what would be changed.
 	// Cache of data gathered from .blackbox:
+	Config   *Config         // If non-nil, the settings.
 	Admins   []string        // If non-empty, the list of admins.
-	Files    []string        // If non-empty, the list of files.
+	Files    []string        // If non-empty, the list of files (keys). See paths.go.
 	FilesSet map[string]bool // If non-nil, a set of Files.
 	// Handles to interfaces:
 	Vcs      vcs.Vcs          // Interface access to the VCS.
@@ -56,6 +60,105 @@ const (
 	Changed
 )
 
+// The VCS diff driver that decrypts files for display.
+const (
+	diffDriver  = "blackbox"
+	diffCommand = "blackbox textconv"
+)
+
+// selfCommand returns the command that runs blackbox on this config dir.
+// It is used when configuring the VCS to call back to us.
+func (bx *Box) selfCommand() string {
+	if bx.Team != "" {
+		return "blackbox --team " + makesafe.Shell(bx.Team)
+	}
+	return "blackbox"
+}
+
+// filterDriver returns the name of the VCS clean/smudge filter, and the
+// commands that implement it. Each team has its own filter. (%f is
+// replaced by the VCS with the file's name.)
+func (bx *Box) filterDriver() (driver, clean, smudge string) {
+	driver = "blackbox"
+	if bx.Team != "" {
+		driver = "blackbox-" + bx.Team
+	}
+	return driver, bx.selfCommand() + " filter clean %f", bx.selfCommand() + " filter smudge %f"
+}
+
+// mergeDriver returns the name of the VCS merge driver, and the command
+// that implements it. Like the filter, each team has its own.
+func (bx *Box) mergeDriver() (driver, command string) {
+	driver, _, _ = bx.filterDriver()
+	return driver, bx.selfCommand() + " merge-driver %O %A %B %P"
+}
+
+// registryFiles are the files in the config dir that list the admins
+// and registered files.
+var registryFiles = []string{"blackbox-admins.txt", "blackbox-files.txt"}
+
+// versionedName returns the name of the file that the VCS stores for the
+// registered file name: the .gpg file or, in ModeFilter, the file itself.
+func (bx *Box) versionedName(name string) (string, error) {
+	filter, err := bx.isFilterMode()
+	if err != nil {
+		return "", err
+	}
+	if filter {
+		return name, nil
+	}
+	return name + ".gpg", nil
+}
+
+// plaintext returns data decrypted, if it is encrypted.
+func (bx *Box) plaintext(data []byte) ([]byte, error) {
+	if !bx.Crypter.IsEncrypted(data) {
+		return data, nil
+	}
+	return bx.Crypter.DecryptBytes(data)
+}
+
+// secret returns the plaintext of the registered file name. It is
+// decrypted in memory; nothing is written to disk.
+func (bx *Box) secret(name string) ([]byte, error) {
+	if err := anyGpg([]string{name}); err != nil {
+		return nil, err
+	}
+	if err := bx.getFiles(); err != nil {
+		return nil, err
+	}
+	key, err := bx.key(name)
+	if err != nil {
+		return nil, err
+	}
+	if !bx.FilesSet[key] {
+		return nil, fmt.Errorf("file %q is not registered", name)
+	}
+	data, err := bx.Crypter.Cat(bx.path(key))
+	if err != nil {
+		return nil, fmt.Errorf("%q: %w", name, err)
+	}
+	return bx.plaintext(data)
+}
+
+// writeEncrypted encrypts data to the admins and writes it to the .gpg
+// file of the registered file key. It returns the .gpg file's name.
+func (bx *Box) writeEncrypted(key string, data []byte) (string, error) {
+	if err := bx.getAdmins(); err != nil {
+		return "", err
+	}
+	encrypted, err := bx.Crypter.EncryptBytes(data, bx.Admins)
+	if err != nil {
+		return "", fmt.Errorf("can not encrypt %q: %w", key, err)
+	}
+	ename := bx.path(key) + ".gpg"
+	err = bx.writeFile(ename, encrypted, 0o666&^os.FileMode(bx.Umask))
+	if err != nil {
+		return "", err
+	}
+	return ename, nil
+}
+
 // NewFromFlags creates a box using items from flags.  Nearly all subcommands use this.
 func NewFromFlags(c *cli.Context) *Box {
 
@@ -73,13 +176,15 @@ func NewFromFlags(c *cli.Context) *Box {
 		logErr:   bblog.GetErr(),
 		logDebug: bblog.GetDebug(c.Bool("debug")),
 		Debug:    c.Bool("debug"),
+		Parallel: c.Int("parallel"),
 	}
+	bx.setDryRun(c.Bool("dry-run"))
 
 	// Discover which kind of VCS is in use, and the repo root.
-	bx.Vcs, bx.RepoBaseDir = vcs.Discover()
+	bx.Vcs, bx.RepoBaseDir = discoverVcs(c.String("vcs"), bx.DryRun)
 
 	// Discover the crypto backend (GnuPG, go-openpgp, etc.)
-	bx.Crypter = crypters.SearchByName(c.String("crypto"), c.Bool("debug"))
+	bx.Crypter = crypters.SearchByName(c.String("crypto"), c.Bool("debug"), bx.DryRun)
 	if bx.Crypter == nil {
 		fmt.Printf("ERROR!  No CRYPTER found! Please set --crypto correctly or use the damn default\n")
 		os.Exit(1)
@@ -107,13 +212,39 @@ func NewFromFlags(c *cli.Context) *Box {
 	}
 	// Normal path. Flag not set, so we discover the path.
 	bx.ConfigPath, err = FindConfigDir(bx.RepoBaseDir, c.String("team"))
-	if err != nil && c.Command.Name != "info" {
+	if err != nil && c.Command.Name != "info" && c.Command.Name != "doctor" {
 		fmt.Printf("Can't find .blackbox or equiv. Have you run init?\n")
 		os.Exit(1)
 	}
+	if bx.RepoBaseDir == "" && err == nil {
+		// The VCS doesn't know the root (repo-less mode). File names
+		// are relative to the directory the config dir is in.
+		bx.RepoBaseDir = configBase(bx.ConfigPath, bx.Team)
+	}
 	return bx
 }
 
+// discoverVcs discovers the VCS (or uses the one named by --vcs) and
+// the path to the repo root. The path is "" if the VCS doesn't know it.
+func discoverVcs(name string, dryRun bool) (vcs.Vcs, string) {
+	v, dir := vcs.Discover(name)
+	if v == nil {
+		fmt.Printf("ERROR!  No VCS named %q! Please set --vcs correctly or leave it unset.\n", name)
+		os.Exit(1)
+	}
+	v.SetDryRun(dryRun)
+	return v, dir
+}
+
+// setDryRun sets dry-run mode. The files are then done one at a time,
+// so that what would be done to each is printed in order.
+func (bx *Box) setDryRun(dryRun bool) {
+	bx.DryRun = dryRun
+	if dryRun {
+		bx.Parallel = 1
+	}
+}
+
 // NewUninitialized creates a box in a pre-init situation.
 func NewUninitialized(c *cli.Context) *Box {
 	/*
@@ -130,8 +261,13 @@ func NewUninitialized(c *cli.Context) *Box {
 		logErr:   bblog.GetErr(),
 		logDebug: bblog.GetDebug(c.Bool("debug")),
 		Debug:    c.Bool("debug"),
+		Parallel: c.Int("parallel"),
+	}
+	bx.setDryRun(c.Bool("dry-run"))
+	bx.Vcs, bx.RepoBaseDir = discoverVcs(c.String("vcs"), bx.DryRun)
+	if bx.RepoBaseDir == "" {
+		bx.RepoBaseDir = "." // Repo-less mode, and no .blackbox_config.
 	}
-	bx.Vcs, bx.RepoBaseDir = vcs.Discover()
 	if c.String("configdir") == "" {
 		rel := ".blackbox"
 		if bx.Team != "" {
@@ -152,6 +288,76 @@ func NewUninitialized(c *cli.Context) *Box {
 	return bx
 }
 
+// Nested returns a box for each repo nested in this one (submodules,
+// repos within its directory tree, and other worktrees), recursively.
+// Each box has its own VCS handle (and therefore its own commits),
+// config dir and admins. Repos without a config dir are skipped.
+func (bx *Box) Nested() ([]*Box, error) {
+	seen := map[string]bool{}
+	if abs, err := filepath.Abs(bx.RepoBaseDir); err == nil {
+		seen[abs] = true
+	}
+
+	var boxes []*Box
+	var walk func(p *Box) error
+	walk = func(p *Box) error {
+		dirs, err := p.Vcs.NestedRepos(p.RepoBaseDir)
+		if err != nil {
+			return err
+		}
+		for _, d := range dirs {
+			dir := filepath.Join(p.RepoBaseDir, d)
+			abs, err := filepath.Abs(dir)
+			if err != nil {
+				return err
+			}
+			if seen[abs] {
+				continue
+			}
+			seen[abs] = true
+
+			nb, err := bx.newNested(dir)
+			if err != nil {
+				return err
+			}
+			if nb.ConfigPath != "" {
+				boxes = append(boxes, nb)
+			}
+			if err := walk(nb); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	err := walk(bx)
+	return boxes, err
+}
+
+// newNested creates a box for the repo at dir (relative to the cwd),
+// with the same settings as bx. ConfigPath is "" if the repo has no
+// config dir.
+func (bx *Box) newNested(dir string) (*Box, error) {
+	v, err := vcs.New(bx.Vcs.Name())
+	if err != nil {
+		return nil, err
+	}
+	v.SetDryRun(bx.DryRun)
+	return &Box{
+		Team:        bx.Team,
+		RepoBaseDir: dir,
+		ConfigPath:  findConfigIn(dir, bx.Team),
+		Umask:       bx.Umask,
+		Editor:      bx.Editor,
+		Debug:       bx.Debug,
+		Parallel:    bx.Parallel,
+		DryRun:      bx.DryRun,
+		Vcs:         v,
+		Crypter:     bx.Crypter,
+		logErr:      bx.logErr,
+		logDebug:    bx.logDebug,
+	}, nil
+}
+
 // NewForTestingInit creates a box in a bare environment.
 func NewForTestingInit(vcsname string) *Box {
 	/*
@@ -220,9 +426,7 @@ func (bx *Box) getFiles() error {
 	if !sort.StringsAreSorted(a) {
 		return fmt.Errorf("file corrupt. Lines not sorted: %v", fn)
 	}
-	for _, n := range a {
-		bx.Files = append(bx.Files, filepath.Join(bx.RepoBaseDir, n))
-	}
+	bx.Files = a
 
 	bx.FilesSet = make(map[string]bool, len(bx.Files))
 	for _, s := range bx.Files {
@@ -231,3 +435,33 @@ func (bx *Box) getFiles() error {
 
 	return nil
 }
+
+// putFiles replaces the list of registered files with keys, and returns
+// the name of the file it was written to.
+func (bx *Box) putFiles(keys []string) (string, error) {
+	a := append([]string(nil), keys...)
+	sort.Strings(a)
+	a = dedup(a)
+
+	// TODO(tlim): Try the json file.
+
+	// Try the legacy file:
+	fn := filepath.Join(bx.ConfigPath, "blackbox-files.txt")
+	bx.logDebug.Printf("Files file: %q", fn)
+	var contents string
+	if len(a) != 0 {
+		contents = strings.Join(a, "\n") + "\n"
+	}
+	err := bx.writeFile(fn, []byte(contents), 0o660)
+	if err != nil {
+		return "", fmt.Errorf("could not update file (%q,%q): %w", fn, keys, err)
+	}
+	bx.Files = a
+
+	bx.FilesSet = make(map[string]bool, len(bx.Files))
+	for _, s := range bx.Files {
+		bx.FilesSet[s] = true
+	}
+
+	return fn, nil
+}
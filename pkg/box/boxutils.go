@@ -2,7 +2,10 @@ package box
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/sha256"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/user"
 	"path/filepath"
@@ -10,6 +13,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/StackExchange/blackbox/v2/pkg/bbutil"
 	"github.com/StackExchange/blackbox/v2/pkg/makesafe"
 )
 
@@ -54,6 +58,42 @@ func FileStatus(name string) (string, error) {
 	return "PLAINERROR", perr
 }
 
+// deepFileStatus returns the status of a file by decrypting the .gpg
+// file (in memory) and comparing it with the plaintext:
+//
+//	UNCHANGED: The plaintext is the same as the decrypted .gpg file.
+//	MODIFIED: The plaintext differs, and is newer. It needs to be encrypted.
+//	STALE: The plaintext differs, and the .gpg file is newer (i.e. another admin changed it). It needs to be decrypted.
+//	UNDECRYPTABLE: The .gpg file can not be decrypted (i.e. we are not an admin).
+//
+// Files that are missing get the same statuses as from FileStatus.
+func (bx *Box) deepFileStatus(name string) (string, error) {
+	stat, err := FileStatus(name)
+	if err != nil || (stat != "ENCRYPTED" && stat != "DECRYPTED") {
+		return stat, err
+	}
+
+	plain, err := ioutil.ReadFile(name)
+	if err != nil {
+		return "PLAINERROR", err
+	}
+	data, err := bx.Crypter.Cat(name)
+	if err == nil {
+		data, err = bx.plaintext(data)
+	}
+	if err != nil {
+		return "UNDECRYPTABLE", err
+	}
+
+	switch {
+	case bytes.Equal(plain, data):
+		return "UNCHANGED", nil
+	case stat == "ENCRYPTED":
+		return "STALE", nil
+	}
+	return "MODIFIED", nil
+}
+
 func anyGpg(names []string) error {
 	for _, name := range names {
 		if strings.HasSuffix(name, ".gpg") {
@@ -140,12 +180,7 @@ func parseGroup(userinput string) (int, error) {
 // If we can't determine the relative path, "" is returned.
 func FindConfigDir(reporoot, team string) (string, error) {
 
-	candidates := []string{}
-	if team != "" {
-		candidates = append(candidates, ".blackbox-"+team)
-	}
-	candidates = append(candidates, ".blackbox")
-	candidates = append(candidates, "keyrings/live")
+	candidates := configCandidates(team)
 	logDebug.Printf("DEBUG: candidates = %q\n", candidates)
 
 	maxDirLevels := 30 // Prevent an infinite loop
@@ -178,6 +213,45 @@ func FindConfigDir(reporoot, team string) (string, error) {
 	return "", fmt.Errorf("No .blackbox (or equiv) directory found")
 }
 
+// configCandidates returns the names the config dir may have, in the
+// order they should be tried.
+func configCandidates(team string) []string {
+	candidates := []string{}
+	if team != "" {
+		candidates = append(candidates, ".blackbox-"+team)
+	}
+	candidates = append(candidates, ".blackbox")
+	candidates = append(candidates, "keyrings/live")
+	return candidates
+}
+
+// configBase returns the directory that contains the config dir
+// configpath (as returned by FindConfigDir).
+func configBase(configpath, team string) string {
+	for _, c := range configCandidates(team) {
+		base := configpath
+		for range strings.Split(c, "/") {
+			base = filepath.Dir(base)
+		}
+		if filepath.Join(base, c) == filepath.Clean(configpath) {
+			return base
+		}
+	}
+	return filepath.Dir(configpath)
+}
+
+// findConfigIn is like FindConfigDir but only looks in reporoot. It
+// returns "" if there is no config dir.
+func findConfigIn(reporoot, team string) string {
+	for _, c := range configCandidates(team) {
+		t := filepath.Join(reporoot, c)
+		if fi, err := os.Stat(t); err == nil && fi.IsDir() {
+			return t
+		}
+	}
+	return ""
+}
+
 func gpgAgentNotice() {
 	// Is gpg-agent configured?
 	if os.Getenv("GPG_AGENT_INFO") != "" {
@@ -190,8 +264,13 @@ func gpgAgentNotice() {
 		return
 	}
 
-	// TODO(tlim): v1 verifies that "gpg-agent --version" outputs a version
-	// string that is 2.1.0 or higher.  It seems that 1.x is incompatible.
+	// Like v1, trust a gpg-agent that is 2.1.0 or higher. (gpg starts
+	// it when it is needed.) 1.x is incompatible.
+	if out, err := bbutil.RunBashOutputSilent("gpg-agent", "--version"); err == nil {
+		if _, ok := bbutil.VersionAtLeast(out, "2.1.0"); ok {
+			return
+		}
+	}
 
 	fmt.Println("WARNING: You probably want to run gpg-agent as")
 	fmt.Println("you will be asked for your passphrase many times.")
@@ -201,12 +280,61 @@ func gpgAgentNotice() {
 	input.Scan()
 }
 
-func shouldWeOverwrite() {
-	fmt.Println()
-	fmt.Println("WARNING: This will overwrite any unencrypted files laying about.")
-	fmt.Print("Press CTRL-C now to stop. ENTER to continue: ")
-	input := bufio.NewScanner(os.Stdin)
-	input.Scan()
+// fileHash returns the SHA-256 hash of the contents of name, and
+// whether it could be read.
+func fileHash(name string) ([sha256.Size]byte, bool) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return [sha256.Size]byte{}, false
+	}
+	return sha256.Sum256(data), true
+}
+
+// writeFile writes data to name. In dry-run mode it only says so.
+func (bx *Box) writeFile(name string, data []byte, perm os.FileMode) error {
+	if bx.DryRun {
+		bbutil.DryRunf("would write %q", name)
+		return nil
+	}
+	return ioutil.WriteFile(name, data, perm)
+}
+
+// chown changes the group of name to gid. In dry-run mode it only says so.
+func (bx *Box) chown(name string, gid int) error {
+	if bx.DryRun {
+		bbutil.DryRunf("would change the group of %q to %d", name, gid)
+		return nil
+	}
+	return os.Chown(name, -1, gid)
+}
+
+// privateTemp writes data to a new file named base in a directory that
+// only we can read, preferably in memory (/dev/shm). It returns the
+// file's name and a function that shreds it and removes the directory.
+func privateTemp(base string, data []byte) (string, func(), error) {
+	dir := ""
+	if fi, err := os.Stat("/dev/shm"); err == nil && fi.IsDir() {
+		dir = "/dev/shm"
+	}
+	tmpdir, err := ioutil.TempDir(dir, "blackbox-edit.")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() {
+		name := filepath.Join(tmpdir, base)
+		if _, err := os.Stat(name); err == nil {
+			bbutil.ShredFiles([]string{name}, 1, false)
+		}
+		os.RemoveAll(tmpdir)
+	}
+
+	// Keep the base name so that the editor knows the file type.
+	name := filepath.Join(tmpdir, base)
+	if err := ioutil.WriteFile(name, data, 0o600); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return name, cleanup, nil
 }
 
 // PrettyCommitMessage generates a pretty commit message.
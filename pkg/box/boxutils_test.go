@@ -0,0 +1,116 @@
+package box
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/StackExchange/blackbox/v2/models"
+)
+
+// fakeCrypter "encrypts" by prefixing data with "ENC:". Data without the
+// prefix can not be decrypted, nor can anything if noKey, as if we
+// lacked the key.
+type fakeCrypter struct {
+	noKey      bool
+	keyIDs     map[string][]string // admin -> key IDs
+	recipients map[string][]string // filename -> key IDs
+}
+
+var errNoKey = errors.New("fake: no secret key")
+
+func (fakeCrypter) Name() string { return "FAKE" }
+func (fakeCrypter) Decrypt(filename string, umask int, overwrite bool) error {
+	return errors.New("fake: not implemented")
+}
+func (fakeCrypter) Encrypt(filename string, umask int, receivers []string) (string, error) {
+	return "", errors.New("fake: not implemented")
+}
+func (fakeCrypter) EncryptBytes(data []byte, receivers []string) ([]byte, error) {
+	return append([]byte("ENC:"), data...), nil
+}
+func (crypt fakeCrypter) Cat(filename string) ([]byte, error) {
+	data, err := ioutil.ReadFile(filename + ".gpg")
+	if err != nil {
+		return nil, err
+	}
+	return crypt.DecryptBytes(data)
+}
+func (crypt fakeCrypter) DecryptBytes(data []byte) ([]byte, error) {
+	if crypt.noKey || !crypt.IsEncrypted(data) {
+		return nil, errNoKey
+	}
+	return bytes.TrimPrefix(data, []byte("ENC:")), nil
+}
+func (fakeCrypter) IsEncrypted(data []byte) bool { return bytes.HasPrefix(data, []byte("ENC:")) }
+func (crypt fakeCrypter) Recipients(filename string) ([]string, error) {
+	return crypt.recipients[filename], nil
+}
+func (crypt fakeCrypter) KeyIDs(keyringdir string, admins []string) (map[string][]string, error) {
+	return crypt.keyIDs, nil
+}
+func (fakeCrypter) AddNewKey(keyname, repobasename, sourcedir, destdir string) ([]string, error) {
+	return nil, errors.New("fake: not implemented")
+}
+func (fakeCrypter) Doctor(keyringdir string, admins []string) []models.Check { return nil }
+
+func TestDeepFileStatus(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "bbdeep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	older := time.Now().Add(-time.Hour)
+	newer := time.Now()
+	bx := &Box{Crypter: fakeCrypter{}}
+	for i, test := range []struct {
+		plain, gpg string // "" means the file is missing.
+		gpgNewer   bool
+		expected   string
+		wantErr    bool
+	}{
+		{"a\n", "ENC:a\n", false, "UNCHANGED", false},
+		{"a\n", "ENC:a\n", true, "UNCHANGED", false},
+		{"b\n", "ENC:a\n", false, "MODIFIED", false},
+		{"b\n", "ENC:a\n", true, "STALE", false},
+		{"a\n", "not for us", false, "UNDECRYPTABLE", true},
+		{"", "ENC:a\n", false, "SHREDDED", false},
+		{"a\n", "", false, "GPGMISSING", false},
+		{"", "", false, "BOTHMISSING", false},
+	} {
+		name := filepath.Join(tmp, "file")
+		os.Remove(name)
+		os.Remove(name + ".gpg")
+		pt, gt := newer, older
+		if test.gpgNewer {
+			pt, gt = older, newer
+		}
+		for _, f := range []struct {
+			name, data string
+			mtime      time.Time
+		}{
+			{name, test.plain, pt},
+			{name + ".gpg", test.gpg, gt},
+		} {
+			if f.data == "" {
+				continue
+			}
+			if err := ioutil.WriteFile(f.name, []byte(f.data), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(f.name, f.mtime, f.mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		g, err := bx.deepFileStatus(name)
+		if g != test.expected || (err != nil) != test.wantErr {
+			t.Errorf("%03d: FAILED got=%q (err=%v) wanted=%q", i, g, err, test.expected)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package box
+
+// config.go -- The optional blackbox-config.json settings file.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// configFile is the name of the settings file within the config dir.
+const configFile = "blackbox-config.json"
+
+// Modes of operation (Config.Mode).
+const (
+	// ModeFiles is the usual workflow: plaintext is ignored by the VCS;
+	// "blackbox encrypt" creates the .gpg files that are checked in.
+	ModeFiles = ""
+	// ModeFilter is the transparent workflow: plaintext is checked in
+	// and the VCS encrypts it via the "blackbox filter" clean/smudge filter.
+	ModeFilter = "filter"
+)
+
+// Config stores the settings in blackbox-config.json. The file is
+// optional, as are all fields.
+type Config struct {
+	Mode       string      `json:"mode,omitempty"`
+	Validators []Validator `json:"validators,omitempty"`
+}
+
+// Validator checks the plaintext of the registered files that match
+// Files before they are encrypted. Either Type (a built-in validator,
+// see validate.Types) or Command is set.
+type Validator struct {
+	// Files is a glob. If it has no "/", it matches the file's base
+	// name. Otherwise it matches the path relative to the repo base.
+	Files   string `json:"files"`
+	Type    string `json:"type,omitempty"`
+	Command string `json:"command,omitempty"`
+}
+
+// getConfig populates Config.
+func (bx *Box) getConfig() error {
+	// Memoized
+	if bx.Config != nil {
+		return nil
+	}
+
+	fn := filepath.Join(bx.ConfigPath, configFile)
+	bx.logDebug.Printf("Config file: %q", fn)
+	c := &Config{}
+	b, err := ioutil.ReadFile(fn)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("getConfig can't load %q: %w", fn, err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, c); err != nil {
+			return fmt.Errorf("getConfig can't parse %q: %w", fn, err)
+		}
+	}
+	switch c.Mode {
+	case ModeFiles, ModeFilter:
+	default:
+		return fmt.Errorf("%q: unknown mode %q", fn, c.Mode)
+	}
+	for i, v := range c.Validators {
+		if err := v.check(); err != nil {
+			return fmt.Errorf("%q: validators[%d]: %w", fn, i, err)
+		}
+	}
+	bx.Config = c
+
+	return nil
+}
+
+// putConfig writes Config to blackbox-config.json and returns the filename.
+func (bx *Box) putConfig() (string, error) {
+	fn := filepath.Join(bx.ConfigPath, configFile)
+	b, err := json.MarshalIndent(bx.Config, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	err = bx.writeFile(fn, append(b, '\n'), 0o660)
+	if err != nil {
+		return "", fmt.Errorf("could not write %q: %w", fn, err)
+	}
+	return fn, nil
+}
+
+// isFilterMode reports whether the VCS encrypts registered files (ModeFilter).
+func (bx *Box) isFilterMode() (bool, error) {
+	if err := bx.getConfig(); err != nil {
+		return false, err
+	}
+	return bx.Config.Mode == ModeFilter, nil
+}
+
+// notInFilterMode returns an error if the repo is in ModeFilter. In that
+// mode the VCS encrypts and decrypts files, not the user.
+func (bx *Box) notInFilterMode(verb string) error {
+	filter, err := bx.isFilterMode()
+	if err != nil {
+		return err
+	}
+	if filter {
+		return fmt.Errorf("%s: not used in filter mode (the VCS encrypts/decrypts registered files)", verb)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package box
+
+// doctor.go -- Checking that blackbox can work here.
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/StackExchange/blackbox/v2/models"
+	"github.com/StackExchange/blackbox/v2/pkg/bbutil"
+	"github.com/StackExchange/blackbox/v2/pkg/makesafe"
+)
+
+// Doctor checks that blackbox can work here: the crypto software and
+// keys, the registry files, the shred command, the VCS, and that the
+// plaintexts are ignored by the VCS. Each check that fails has a hint
+// on how to fix it.
+func (bx *Box) Doctor() []models.Check {
+	if bx.ConfigPath == "" {
+		// Most checks need the config dir.
+		return append(bx.Crypter.Doctor("", nil),
+			models.Check{
+				Name:   "config dir",
+				Detail: "no .blackbox (or equiv.) directory found",
+				Hint:   "Run blackbox in a repo that uses it, or set it up: blackbox init",
+			},
+			checkShred(),
+			bx.checkVcs(),
+		)
+	}
+
+	// Problems with the admins are reported by checkRegistry.
+	bx.getAdmins()
+
+	var checks []models.Check
+	checks = append(checks, bx.Crypter.Doctor(bx.ConfigPath, bx.Admins)...)
+	checks = append(checks,
+		bx.checkRegistry("blackbox-admins.txt"),
+		bx.checkRegistry("blackbox-files.txt"),
+		bx.checkConfig(),
+		checkShred(),
+		bx.checkIgnored(),
+		bx.checkVcs(),
+	)
+	return checks
+}
+
+// registryProblems lists what is wrong with the lines of a registry
+// file (blackbox-admins.txt or blackbox-files.txt). They must be sorted
+// (by byte), without duplicates or blank lines.
+func registryProblems(lines []string) []string {
+	var problems []string
+	for i, l := range lines {
+		switch {
+		case strings.TrimSpace(l) == "":
+			problems = append(problems, fmt.Sprintf("line %d is blank", i+1))
+		case strings.TrimSpace(l) != l:
+			problems = append(problems, fmt.Sprintf("line %d %q has leading or trailing spaces", i+1, l))
+		case i == 0:
+		case l == lines[i-1]:
+			problems = append(problems, fmt.Sprintf("line %d %q is a duplicate", i+1, l))
+		case l < lines[i-1]:
+			problems = append(problems, fmt.Sprintf("line %d %q is out of order", i+1, l))
+		}
+	}
+	return problems
+}
+
+// checkRegistry checks the registry file base in the config dir.
+func (bx *Box) checkRegistry(base string) models.Check {
+	fn := filepath.Join(bx.ConfigPath, base)
+	c := models.Check{Name: base}
+	lines, err := bbutil.ReadFileLines(fn)
+	if err != nil {
+		c.Detail = err.Error()
+		c.Hint = "It should exist, and be readable. (blackbox init creates it.)"
+		return c
+	}
+	if p := registryProblems(lines); len(p) != 0 {
+		c.Detail = strings.Join(p, "; ")
+		c.Hint = fmt.Sprintf("Edit out blank lines and spaces. Sort it and remove duplicates: LC_ALL=C sort -u -o %s %s",
+			makesafe.Shell(fn), makesafe.Shell(fn))
+		return c
+	}
+	c.Detail = fmt.Sprintf("%d entries, sorted", len(lines))
+	c.OK = true
+	return c
+}
+
+// checkConfig checks the optional blackbox-config.json.
+func (bx *Box) checkConfig() models.Check {
+	c := models.Check{Name: configFile}
+	if err := bx.getConfig(); err != nil {
+		c.Detail = err.Error()
+		c.Hint = "Fix it. See docs/advanced.md for the settings."
+		return c
+	}
+	c.Detail = "ok (or absent, which is fine)"
+	if bx.Config.Mode == ModeFilter {
+		c.Detail = "ok, filter mode"
+	}
+	c.OK = true
+	return c
+}
+
+// checkShred checks that there is a command to shred plaintexts with.
+func checkShred() models.Check {
+	c := models.Check{Name: "shred"}
+	s := strings.TrimSpace(bbutil.ShredInfo())
+	if s == "" {
+		c.Detail = "no shred command found; plaintexts are deleted, not overwritten"
+		c.Hint = "Install shred (GNU coreutils), srm or sdelete."
+		return c
+	}
+	c.Detail = s
+	c.OK = true
+	return c
+}
+
+// checkIgnored checks that the VCS ignores the plaintext of every
+// registered file, so that they can't be checked in by mistake.
+func (bx *Box) checkIgnored() models.Check {
+	c := models.Check{Name: "plaintexts ignored"}
+	if err := bx.getFiles(); err != nil {
+		c.Detail = err.Error()
+		c.Hint = "Fix blackbox-files.txt first."
+		return c
+	}
+	if filter, err := bx.isFilterMode(); err == nil && filter {
+		c.Detail = "not needed in filter mode (the VCS encrypts them)"
+		c.OK = true
+		return c
+	}
+	ignored, err := bx.Vcs.Ignored(bx.RepoBaseDir, bx.Files)
+	if err != nil {
+		c.Detail = err.Error()
+		return c
+	}
+	isIgnored := make(map[string]bool, len(ignored))
+	for _, key := range ignored {
+		isIgnored[key] = true
+	}
+	var not []string
+	for _, key := range bx.Files {
+		if !isIgnored[key] {
+			not = append(not, bx.path(key))
+		}
+	}
+	if len(not) != 0 {
+		c.Detail = fmt.Sprintf("%d not ignored: %s", len(not), makesafe.FirstFew(makesafe.ShellMany(not)))
+		c.Hint = "Regenerate the ignores: blackbox vcs sync"
+		return c
+	}
+	c.Detail = fmt.Sprintf("all %d are ignored", len(bx.Files))
+	c.OK = true
+	return c
+}
+
+// checkVcs checks that the VCS (and the base of the repo) was found.
+func (bx *Box) checkVcs() models.Check {
+	c := models.Check{Name: "vcs"}
+	if _, root := bx.Vcs.Discover(); root == "" {
+		c.Detail = fmt.Sprintf("%s, base of the repo unknown", bx.Vcs.Name())
+		c.Hint = "Run blackbox in a git repo. (For a tree without a VCS, create .blackbox_config at its top.)"
+		return c
+	}
+	c.Detail = fmt.Sprintf("%s, repo at %q", bx.Vcs.Name(), bx.RepoBaseDir)
+	c.OK = true
+	return c
+}
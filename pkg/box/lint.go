@@ -0,0 +1,225 @@
+package box
+
+// lint.go -- Checking the repo's invariants (i.e. in CI).
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/StackExchange/blackbox/v2/pkg/bbutil"
+)
+
+// LintResult is the result of one of Lint's checks.
+type LintResult struct {
+	Name     string   `json:"name"`
+	Problems []string `json:"problems"`          // Empty if the check passed.
+	Skipped  string   `json:"skipped,omitempty"` // Why the check was not done.
+}
+
+// Lint checks the repo's invariants: the registry files are sorted,
+// without duplicates or files outside the repo; every registered file
+// is encrypted, to exactly the admins; no plaintext is tracked by the
+// VCS; and every .gpg file is registered. Nothing is decrypted, so no
+// secret key is needed (as in CI).
+func (bx *Box) Lint() ([]LintResult, error) {
+	filter, err := bx.isFilterMode()
+	if err != nil {
+		return nil, err
+	}
+
+	results := []LintResult{
+		bx.lintRegistry("blackbox-admins.txt", nil),
+		bx.lintRegistry("blackbox-files.txt", bx.keyProblem),
+	}
+
+	// The other checks need the registry.
+	var skipFiles, skipAdmins string
+	if err := bx.getFiles(); err != nil {
+		skipFiles = err.Error()
+	}
+	if err := bx.getAdmins(); err != nil {
+		skipAdmins = err.Error()
+	}
+	// Files outside the repo are reported by lintRegistry, and not read.
+	var keys []string
+	for _, key := range bx.Files {
+		if bx.keyProblem(key) == "" {
+			keys = append(keys, key)
+		}
+	}
+	var skipTracked string
+	if bx.Vcs.Name() == "NONE" {
+		skipTracked = "there is no VCS"
+	}
+	var skipGpg string
+	if filter {
+		skipGpg = "filter mode (the VCS encrypts the files)"
+	}
+
+	results = append(results,
+		lint("registered files are encrypted", func() []string { return bx.lintEncrypted(keys) }, skipFiles, skipGpg),
+		lint("plaintexts are not tracked", bx.lintTracked, skipFiles, skipGpg, skipTracked),
+		lint("no unregistered .gpg files", bx.lintOrphans, skipFiles, skipTracked),
+		lint("encrypted to the admins", func() []string { return bx.lintRecipients(keys) }, skipFiles, skipAdmins, skipGpg),
+	)
+	return results, nil
+}
+
+// lint runs check, unless one of the reasons to skip it isn't "".
+func lint(name string, check func() []string, skip ...string) LintResult {
+	r := LintResult{Name: name, Problems: []string{}}
+	for _, s := range skip {
+		if s != "" {
+			r.Skipped = s
+			return r
+		}
+	}
+	if p := check(); len(p) != 0 {
+		r.Problems = p
+	}
+	return r
+}
+
+// lintRegistry checks the registry file base in the config dir, and each
+// line with lineProblem (if not nil).
+func (bx *Box) lintRegistry(base string, lineProblem func(string) string) LintResult {
+	r := LintResult{Name: base, Problems: []string{}}
+	lines, err := bbutil.ReadFileLines(filepath.Join(bx.ConfigPath, base))
+	if err != nil {
+		r.Problems = append(r.Problems, err.Error())
+		return r
+	}
+	r.Problems = append(r.Problems, registryProblems(lines)...)
+	if lineProblem != nil {
+		for i, l := range lines {
+			if p := lineProblem(l); p != "" {
+				r.Problems = append(r.Problems, fmt.Sprintf("line %d %q %s", i+1, l, p))
+			}
+		}
+	}
+	return r
+}
+
+// keyProblem returns what is wrong with key (a line of
+// blackbox-files.txt), or "" if it names a file in the repo.
+func (bx *Box) keyProblem(key string) string {
+	if key == "" || filepath.IsAbs(key) || path.IsAbs(key) {
+		return "is not relative to the base of the repo"
+	}
+	if c := path.Clean(key); c == ".." || strings.HasPrefix(c, "../") {
+		return "is outside the repo"
+	}
+	// This follows symlinks, which may lead out of the repo.
+	k, err := bx.key(bx.path(key))
+	if err != nil {
+		return "is outside the repo"
+	}
+	if k != key {
+		return fmt.Sprintf("should be %q", k)
+	}
+	return ""
+}
+
+// lintEncrypted checks that every one of keys has a .gpg file.
+func (bx *Box) lintEncrypted(keys []string) []string {
+	var problems []string
+	for _, key := range keys {
+		if !bbutil.FileExistsOrProblem(bx.path(key) + ".gpg") {
+			problems = append(problems, fmt.Sprintf("%s.gpg is missing", key))
+		}
+	}
+	return problems
+}
+
+// lintTracked checks that the VCS tracks no registered file's plaintext.
+func (bx *Box) lintTracked() []string {
+	tracked, err := bx.Vcs.TrackedFiles(bx.RepoBaseDir)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var problems []string
+	for _, f := range tracked {
+		if bx.FilesSet[f] {
+			problems = append(problems, fmt.Sprintf("%s is tracked by %s", f, bx.Vcs.Name()))
+		}
+	}
+	return problems
+}
+
+// lintOrphans checks that every .gpg file tracked by the VCS is the
+// encrypted version of a registered file. The config dir (and the
+// keyrings in it) is exempt.
+func (bx *Box) lintOrphans() []string {
+	tracked, err := bx.Vcs.TrackedFiles(bx.RepoBaseDir)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	// The config dir may be outside the repo, in which case it has no key.
+	configDir, _ := bx.key(bx.ConfigPath)
+	var problems []string
+	for _, f := range tracked {
+		if !strings.HasSuffix(f, ".gpg") || bx.FilesSet[strings.TrimSuffix(f, ".gpg")] {
+			continue
+		}
+		if configDir != "" && strings.HasPrefix(f, configDir+"/") {
+			continue
+		}
+		problems = append(problems, fmt.Sprintf("%s is not registered", f))
+	}
+	return problems
+}
+
+// lintRecipients checks that the .gpg file of every one of keys is
+// encrypted to every admin and to no one else.
+func (bx *Box) lintRecipients(keys []string) []string {
+	adminKeys, err := bx.Crypter.KeyIDs(bx.ConfigPath, bx.Admins)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var problems []string
+	owner := make(map[string]string) // key ID -> admin
+	for _, a := range bx.Admins {
+		if len(adminKeys[a]) == 0 {
+			problems = append(problems, fmt.Sprintf("admin %s has no key in the repo's keyring", a))
+		}
+		for _, id := range adminKeys[a] {
+			owner[id] = a
+		}
+	}
+
+	perFile := make([][]string, len(keys))
+	bbutil.Parallel(bx.Parallel, len(keys), ioutil.Discard, func(i int, out io.Writer) error {
+		key := keys[i]
+		if !bbutil.FileExistsOrProblem(bx.path(key) + ".gpg") {
+			return nil // Reported by lintEncrypted.
+		}
+		ids, err := bx.Crypter.Recipients(bx.path(key))
+		if err != nil {
+			perFile[i] = []string{err.Error()}
+			return err
+		}
+		to := make(map[string]bool)
+		for _, id := range ids {
+			a, ok := owner[id]
+			if !ok {
+				perFile[i] = append(perFile[i], fmt.Sprintf("%s.gpg is encrypted to key %s, which is not an admin's", key, id))
+				continue
+			}
+			to[a] = true
+		}
+		for _, a := range bx.Admins {
+			if !to[a] && len(adminKeys[a]) != 0 {
+				perFile[i] = append(perFile[i], fmt.Sprintf("%s.gpg is not encrypted to admin %s", key, a))
+			}
+		}
+		return nil
+	})
+	for _, p := range perFile {
+		problems = append(problems, p...)
+	}
+	return problems
+}
@@ -0,0 +1,160 @@
+package box
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/StackExchange/blackbox/v2/models"
+	"github.com/StackExchange/blackbox/v2/pkg/bblog"
+	"github.com/StackExchange/blackbox/v2/pkg/vcs/none"
+)
+
+func TestKeyProblem(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "bblint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// tmp/repo/out is a symlink to tmp, outside the repo.
+	repo := filepath.Join(tmp, "repo")
+	if err := os.MkdirAll(filepath.Join(repo, "sub"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(tmp, filepath.Join(repo, "out")); err != nil {
+		t.Fatal(err)
+	}
+
+	bx := &Box{RepoBaseDir: repo}
+	for i, test := range []struct {
+		key string
+		ok  bool
+	}{
+		{"x.txt", true},
+		{"sub/x.txt", true},
+		{"new/dir/x.txt", true},
+		{"", false},
+		{"/etc/passwd", false},
+		{"../x.txt", false},
+		{"sub/../../x.txt", false},
+		{"./x.txt", false},
+		{"sub//x.txt", false},
+		{"out/x.txt", false},
+	} {
+		if p := bx.keyProblem(test.key); (p == "") != test.ok {
+			t.Errorf("%03d: FAILED %q: problem=%q", i, test.key, p)
+		}
+	}
+}
+
+// fakeVcs is a VCS that tracks the files in tracked and has one commit,
+// "c1", with the files in history (name -> contents). Only the methods
+// that Lint and AuditHistory use are implemented.
+type fakeVcs struct {
+	models.Vcs
+	tracked []string
+	history map[string]string
+}
+
+func (fakeVcs) Name() string { return "FAKE" }
+func (v fakeVcs) TrackedFiles(repobasedir string) ([]string, error) {
+	return v.tracked, nil
+}
+func (v fakeVcs) WalkHistory(repobasedir string, fn func(c models.Commit, files []models.TreeEntry) error) error {
+	var files []models.TreeEntry
+	for name, data := range v.history {
+		h, _ := v.HashContent(repobasedir, []byte(data))
+		files = append(files, models.TreeEntry{Name: name, Hash: h})
+	}
+	return fn(models.Commit{ID: "c1"}, files)
+}
+func (fakeVcs) HashContent(repobasedir string, data []byte) (string, error) {
+	return "H:" + string(data), nil
+}
+func (v fakeVcs) CatRevision(repobasedir string, rev string, name string) ([]byte, error) {
+	data, ok := v.history[name]
+	if rev != "c1" || !ok {
+		return nil, os.ErrNotExist
+	}
+	return []byte(data), nil
+}
+
+func TestLint(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "bblint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// a.txt is encrypted to alice (K1) and to mallory (K9), b.txt only
+	// to bob (K2).
+	config := filepath.Join(tmp, ".blackbox")
+	for name, data := range map[string]string{
+		".blackbox/blackbox-admins.txt": "alice\nbob\n",
+		".blackbox/blackbox-files.txt":  "a.txt\nb.txt\nc.txt\n",
+		"a.txt.gpg":                     "ENC:a",
+		"b.txt.gpg":                     "ENC:b",
+	} {
+		fn := filepath.Join(tmp, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fn), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fn, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	crypt := fakeCrypter{
+		keyIDs: map[string][]string{"alice": {"K1"}, "bob": {"K2", "K3"}},
+		recipients: map[string][]string{
+			filepath.Join(tmp, "a.txt"): {"K1", "K3", "K9"},
+			filepath.Join(tmp, "b.txt"): {"K2"},
+		},
+	}
+
+	for i, test := range []struct {
+		vcs      models.Vcs
+		expected map[string]string // check -> problems (joined by "; ") or "SKIPPED"
+	}{
+		{&none.VcsHandle{}, map[string]string{
+			"blackbox-admins.txt":            "",
+			"blackbox-files.txt":             "",
+			"registered files are encrypted": "c.txt.gpg is missing",
+			"plaintexts are not tracked":     "SKIPPED",
+			"no unregistered .gpg files":     "SKIPPED",
+			"encrypted to the admins":        "a.txt.gpg is encrypted to key K9, which is not an admin's; b.txt.gpg is not encrypted to admin alice",
+		}},
+		{fakeVcs{tracked: []string{".blackbox/pubring.gpg", "a.txt.gpg", "b.txt", "d.txt.gpg"}}, map[string]string{
+			"plaintexts are not tracked": "b.txt is tracked by FAKE",
+			"no unregistered .gpg files": "d.txt.gpg is not registered",
+		}},
+	} {
+		bx := &Box{
+			RepoBaseDir: tmp,
+			ConfigPath:  config,
+			Vcs:         test.vcs,
+			Crypter:     crypt,
+			logErr:      bblog.GetErr(),
+			logDebug:    bblog.GetDebug(false),
+		}
+		results, err := bx.Lint()
+		if err != nil {
+			t.Fatalf("%03d: FAILED %v", i, err)
+		}
+		for _, r := range results {
+			want, ok := test.expected[r.Name]
+			if !ok {
+				continue
+			}
+			g := strings.Join(r.Problems, "; ")
+			if r.Skipped != "" {
+				g = "SKIPPED"
+			}
+			if g != want {
+				t.Errorf("%03d: FAILED %q: got=%q wanted=%q", i, r.Name, g, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package box
+
+// managed.go -- The ignores and attributes that blackbox maintains in the VCS.
+
+import (
+	"path/filepath"
+
+	"github.com/StackExchange/blackbox/v2/models"
+)
+
+// managed returns the ignores and attributes the VCS needs, generated
+// from the registry. The registry files are kept with unix line endings.
+// In ModeFiles the plaintext is ignored and the .gpg files are diffed
+// and merged by blackbox. In ModeFilter the files themselves are.
+func (bx *Box) managed() (models.Managed, error) {
+	if err := bx.getFiles(); err != nil {
+		return models.Managed{}, err
+	}
+	filter, err := bx.isFilterMode()
+	if err != nil {
+		return models.Managed{}, err
+	}
+	driver, _, _ := bx.filterDriver()
+	mdriver, _ := bx.mergeDriver()
+
+	m := models.Managed{
+		Block: driver,
+		IgnoreAnywhere: []string{
+			"pubring.gpg~",
+			"pubring.kbx~",
+			"secring.gpg",
+		},
+	}
+
+	for _, r := range registryFiles {
+		key, err := bx.key(filepath.Join(bx.ConfigPath, r))
+		if err != nil {
+			continue // The config dir isn't in the repo.
+		}
+		m.Attributes = append(m.Attributes, models.Attribute{
+			Name:  key,
+			Attrs: []string{"text eol=lf", "merge=" + mdriver},
+		})
+	}
+
+	for _, key := range bx.Files {
+		if filter {
+			m.Attributes = append(m.Attributes, models.Attribute{
+				Name:  key,
+				Attrs: []string{"filter=" + driver, "diff=" + diffDriver, "merge=" + mdriver},
+			})
+			continue
+		}
+		m.Ignore = append(m.Ignore, key)
+		m.Attributes = append(m.Attributes, models.Attribute{
+			Name:  key + ".gpg",
+			Attrs: []string{"diff=" + diffDriver, "merge=" + mdriver},
+		})
+	}
+
+	return m, nil
+}
+
+// syncVcs regenerates the ignores and attributes that blackbox maintains.
+// Call it whenever the registry or the mode changes.
+func (bx *Box) syncVcs() error {
+	m, err := bx.managed()
+	if err != nil {
+		return err
+	}
+	return bx.Vcs.SetManaged(bx.RepoBaseDir, m)
+}
+
+// setDrivers configures the VCS to call blackbox to diff and merge
+// files and, in ModeFilter, to encrypt and decrypt them.
+func (bx *Box) setDrivers() error {
+	filter, err := bx.isFilterMode()
+	if err != nil {
+		return err
+	}
+	if filter {
+		driver, clean, smudge := bx.filterDriver()
+		err := bx.Vcs.SetFilterDriver(bx.RepoBaseDir, driver, clean, smudge)
+		if err != nil {
+			return err
+		}
+	}
+	err = bx.Vcs.SetDiffDriver(bx.RepoBaseDir, diffDriver, diffCommand)
+	if err != nil {
+		return err
+	}
+	mdriver, mcommand := bx.mergeDriver()
+	return bx.Vcs.SetMergeDriver(bx.RepoBaseDir, mdriver, mcommand)
+}
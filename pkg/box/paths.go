@@ -0,0 +1,85 @@
+package box
+
+// Path canonicalization.
+
+// Users name files relative to the cwd (which may be anywhere in the
+// repo), or by absolute path, possibly through a symlink. The registry
+// (blackbox-files.txt) stores each file by its "key": its path relative
+// to the repo base, cleaned, with "/" as the separator. Keys are used
+// for storage and lookup (bx.Files, bx.FilesSet) and with the VCS.
+// Paths (relative to the cwd) are used to access the file system and
+// in messages to the user.
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// key returns the key of name, which is relative to the cwd or
+// absolute. It is an error if name is not within the repo.
+func (bx *Box) key(name string) (string, error) {
+	base, err := realpath(bx.RepoBaseDir)
+	if err != nil {
+		return "", err
+	}
+	abs, err := realpath(name)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(base, abs)
+	if err != nil {
+		return "", fmt.Errorf("%q is not in the repo: %w", name, err)
+	}
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%q is not in the repo (%s)", name, base)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// keys returns the keys of names.
+func (bx *Box) keys(names []string) ([]string, error) {
+	var keys []string
+	for _, n := range names {
+		k, err := bx.key(n)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// path returns the path of key, relative to the cwd.
+func (bx *Box) path(key string) string {
+	return filepath.Join(bx.RepoBaseDir, filepath.FromSlash(key))
+}
+
+// paths returns the paths of keys.
+func (bx *Box) paths(keys []string) []string {
+	var paths []string
+	for _, k := range keys {
+		paths = append(paths, bx.path(k))
+	}
+	return paths
+}
+
+// realpath returns the absolute path of name with any symlinks
+// resolved. Unlike filepath.EvalSymlinks, name need not exist. (The
+// plaintext usually doesn't.) Only the part that exists is resolved.
+func realpath(name string) (string, error) {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return "", err
+	}
+	var missing []string
+	for p := abs; ; p = filepath.Dir(p) {
+		if r, err := filepath.EvalSymlinks(p); err == nil {
+			return filepath.Join(append([]string{r}, missing...)...), nil
+		}
+		if p == filepath.Dir(p) {
+			return abs, nil
+		}
+		missing = append([]string{filepath.Base(p)}, missing...)
+	}
+}
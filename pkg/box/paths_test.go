@@ -0,0 +1,66 @@
+package box
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKey(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "bbpaths")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// tmp/repo/sub/dir is the cwd. tmp/link is a symlink to tmp/repo.
+	repo := filepath.Join(tmp, "repo")
+	if err := os.MkdirAll(filepath.Join(repo, "sub", "dir"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(repo, filepath.Join(tmp, "link")); err != nil {
+		t.Fatal(err)
+	}
+	olddir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(olddir)
+	if err := os.Chdir(filepath.Join(repo, "sub", "dir")); err != nil {
+		t.Fatal(err)
+	}
+
+	bx := &Box{RepoBaseDir: filepath.Join("..", "..")}
+	for i, test := range []struct {
+		name     string
+		expected string // "" means an error is expected.
+	}{
+		{"x.txt", "sub/dir/x.txt"},
+		{"./x.txt", "sub/dir/x.txt"},
+		{"../y.txt", "sub/y.txt"},
+		{"../../z.txt", "z.txt"},
+		{"../dir/../../z.txt", "z.txt"},
+		{filepath.Join(repo, "sub", "x.txt"), "sub/x.txt"},
+		{filepath.Join(tmp, "link", "sub", "x.txt"), "sub/x.txt"},
+		{"new/dir/x.txt", "sub/dir/new/dir/x.txt"},
+		{"../../../outside.txt", ""},
+		{filepath.Join(tmp, "outside.txt"), ""},
+		{"../..", ""},
+	} {
+		g, err := bx.key(test.name)
+		if test.expected == "" {
+			if err == nil {
+				t.Errorf("%03d: FAILED %q: expected an error, got %q", i, test.name, g)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%03d: FAILED %q: %v", i, test.name, err)
+		} else if g != test.expected {
+			t.Errorf("%03d: FAILED %q: got %q wanted %q", i, test.name, g, test.expected)
+		} else if p := bx.path(g); filepath.Clean(p) != filepath.Clean(filepath.Join("..", "..", test.expected)) {
+			t.Errorf("%03d: FAILED %q: path=%q", i, test.name, p)
+		}
+	}
+}
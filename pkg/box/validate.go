@@ -0,0 +1,107 @@
+package box
+
+// validate.go -- Checking plaintext with the validators in the config.
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/StackExchange/blackbox/v2/pkg/validate"
+)
+
+// check returns an error if v is not a valid Validator.
+func (v Validator) check() error {
+	if v.Files == "" {
+		return fmt.Errorf("files is empty")
+	}
+	if _, err := path.Match(v.Files, ""); err != nil {
+		return fmt.Errorf("files %q: %w", v.Files, err)
+	}
+	if (v.Type == "") == (v.Command == "") {
+		return fmt.Errorf("set either type or command")
+	}
+	if v.Type != "" {
+		for _, t := range validate.Types() {
+			if t == v.Type {
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown type %q (expected one of %s)", v.Type, strings.Join(validate.Types(), ", "))
+	}
+	return nil
+}
+
+// matches reports whether v applies to the registered file key.
+func (v Validator) matches(key string) bool {
+	name := key
+	if !strings.Contains(v.Files, "/") {
+		name = path.Base(key)
+	}
+	ok, _ := path.Match(v.Files, name)
+	return ok
+}
+
+// validators returns the validators that apply to the registered file key.
+func (bx *Box) validators(key string) ([]Validator, error) {
+	if err := bx.getConfig(); err != nil {
+		return nil, err
+	}
+	var vs []Validator
+	for _, v := range bx.Config.Validators {
+		if v.matches(key) {
+			vs = append(vs, v)
+		}
+	}
+	return vs, nil
+}
+
+// validate checks data, the plaintext of the registered file key, with
+// the validators that apply to it.
+func (bx *Box) validate(key string, data []byte) error {
+	vs, err := bx.validators(key)
+	if err != nil {
+		return err
+	}
+	for _, v := range vs {
+		if v.Type != "" {
+			err = validate.Check(v.Type, data)
+		} else {
+			err = validate.Command(v.Command, key, data)
+		}
+		if err != nil {
+			return fmt.Errorf("%q is not valid (%s): %w", bx.path(key), v, err)
+		}
+	}
+	return nil
+}
+
+func (v Validator) String() string {
+	if v.Type != "" {
+		return v.Type
+	}
+	return v.Command
+}
+
+// askReedit reports err and asks whether to run the editor again.
+func askReedit(err error) bool {
+	fmt.Printf("ERROR: %v\n", err)
+	fmt.Print("Re-open the editor? [Y/n] ")
+	// Read one byte at a time so that no later input is consumed.
+	var answer []byte
+	b := make([]byte, 1)
+	for {
+		n, err := os.Stdin.Read(b)
+		if n == 0 || err != nil {
+			fmt.Println()
+			return false
+		}
+		if b[0] == '\n' {
+			break
+		}
+		answer = append(answer, b[0])
+	}
+	a := strings.ToLower(strings.TrimSpace(string(answer)))
+	return a == "" || a == "y" || a == "yes"
+}
@@ -5,17 +5,28 @@ package box
 // external sytems that use box as a module.
 import (
 	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
+	"syscall"
 
+	"github.com/StackExchange/blackbox/v2/models"
 	"github.com/StackExchange/blackbox/v2/pkg/bbutil"
+	"github.com/StackExchange/blackbox/v2/pkg/dotenv"
 	"github.com/StackExchange/blackbox/v2/pkg/makesafe"
-	"github.com/olekukonko/tablewriter"
+	"github.com/StackExchange/blackbox/v2/pkg/structured"
+	"github.com/StackExchange/blackbox/v2/pkg/textdiff"
 )
 
 // AdminAdd adds admins.
@@ -43,7 +54,11 @@ func (bx *Box) AdminAdd(nom string, sdir string) error {
 	// Try the legacy file:
 	fn := filepath.Join(bx.ConfigPath, "blackbox-admins.txt")
 	bx.logDebug.Printf("Admins file: %q", fn)
-	err = bbutil.AddLinesToSortedFile(fn, nom)
+	if bx.DryRun {
+		bbutil.DryRunf("would add %q to %q", nom, fn)
+	} else {
+		err = bbutil.AddLinesToSortedFile(fn, nom)
+	}
 	if err != nil {
 		return fmt.Errorf("could not update file (%q,%q): %v", fn, nom, err)
 	}
@@ -53,17 +68,23 @@ func (bx *Box) AdminAdd(nom string, sdir string) error {
 	return nil
 }
 
-// AdminList lists the admin id's.
-func (bx *Box) AdminList() error {
+// Admin is an entry in the list of admins.
+type Admin struct {
+	ID string `json:"id"` // The GnuPG user-id (usually an email address).
+}
+
+// AdminList lists the admins.
+func (bx *Box) AdminList() ([]Admin, error) {
 	err := bx.getAdmins()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	for _, v := range bx.Admins {
-		fmt.Println(v)
+	admins := make([]Admin, len(bx.Admins))
+	for i, v := range bx.Admins {
+		admins[i] = Admin{ID: v}
 	}
-	return nil
+	return admins, nil
 }
 
 // AdminRemove removes an id from the admin list.
@@ -71,8 +92,107 @@ func (bx *Box) AdminRemove([]string) error {
 	return fmt.Errorf("NOT IMPLEMENTED: AdminRemove")
 }
 
-// Cat outputs a file, unencrypting if needed.
-func (bx *Box) Cat(names []string) error {
+// AuditFinding is one instance of a secret leaked into the VCS history.
+type AuditFinding struct {
+	Commit  string `json:"commit"`
+	Author  string `json:"author"`
+	Date    string `json:"date"`
+	Path    string `json:"path"`   // The file in the commit, relative to the repo base.
+	Secret  string `json:"secret"` // The registered file that leaked.
+	Reason  string `json:"reason"` // "path" or "content". See AuditHistory.
+	Subject string `json:"subject"`
+}
+
+// AuditHistory scans every commit in the VCS history for leaked secrets.
+// It reports the commits that added or changed a registered file's plaintext
+// (Reason: "path") and files whose contents match a registered file's
+// current plaintext (Reason: "content"). In filter mode, where the VCS
+// stores registered files encrypted, only versions that are not
+// encrypted are reported by path. The report is printed as JSON.
+func (bx *Box) AuditHistory() error {
+	err := bx.getFiles()
+	if err != nil {
+		return err
+	}
+	filter, err := bx.isFilterMode()
+	if err != nil {
+		return err
+	}
+
+	// The VCS reports names relative to the repo base, like keys.
+	secrets := make(map[string]string, len(bx.Files)) // key -> name
+	for _, key := range bx.Files {
+		secrets[key] = bx.path(key)
+	}
+
+	// Hash the current plaintext of each secret so that copies can be
+	// found under any name. This requires that we can decrypt them.
+	hashes := make(map[string]string, len(bx.Files)) // hash -> name
+	for _, name := range bx.paths(bx.Files) {
+		plaintext, err := bx.Crypter.Cat(name)
+		if err != nil {
+			bx.logErr.Printf("Can not decrypt %q (will only audit by name): %v", name, err)
+			continue
+		}
+		h, err := bx.Vcs.HashContent(bx.RepoBaseDir, plaintext)
+		if err != nil {
+			return err
+		}
+		hashes[h] = name
+	}
+
+	findings := []AuditFinding{}
+	commits := 0
+	err = bx.Vcs.WalkHistory(bx.RepoBaseDir, func(c models.Commit, files []models.TreeEntry) error {
+		commits++
+		for _, f := range files {
+			finding := AuditFinding{
+				Commit:  c.ID,
+				Author:  c.Author,
+				Date:    c.Date,
+				Path:    f.Name,
+				Subject: c.Subject,
+			}
+			name, ok := secrets[f.Name]
+			if ok && filter {
+				data, err := bx.Vcs.CatRevision(bx.RepoBaseDir, c.ID, f.Name)
+				if err != nil {
+					return err
+				}
+				ok = !bx.Crypter.IsEncrypted(data)
+			}
+			if ok {
+				finding.Secret, finding.Reason = name, "path"
+			} else if name, ok := hashes[f.Hash]; ok {
+				finding.Secret, finding.Reason = name, "content"
+			} else {
+				continue
+			}
+			findings = append(findings, finding)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("audit history: %w", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false) // Leave "<" in "Author <email>" alone.
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(findings); err != nil {
+		return err
+	}
+
+	bx.logErr.Printf("Audited %d commits. Found %d leaks.", commits, len(findings))
+	if len(findings) != 0 {
+		return fmt.Errorf("leaked secrets found in the %s history. Rotate them", bx.Vcs.Name())
+	}
+	return nil
+}
+
+// Cat outputs a file, unencrypting if needed. If rev is not "", the
+// file is output as of that revision (the working tree is not used).
+func (bx *Box) Cat(names []string, rev string) error {
 	if err := anyGpg(names); err != nil {
 		return fmt.Errorf("cat: %w", err)
 	}
@@ -83,9 +203,14 @@ func (bx *Box) Cat(names []string) error {
 	}
 
 	for _, name := range names {
+		key, err := bx.key(name)
+		if err != nil {
+			return fmt.Errorf("cat: %w", err)
+		}
 		var out []byte
-		var err error
-		if _, ok := bx.FilesSet[name]; ok {
+		if rev != "" {
+			out, err = catRevision(bx, key, rev)
+		} else if _, ok := bx.FilesSet[key]; ok {
 			out, err = bx.Crypter.Cat(name)
 		} else {
 			out, err = ioutil.ReadFile(name)
@@ -99,17 +224,40 @@ func (bx *Box) Cat(names []string) error {
 	return nil
 }
 
-// Decrypt decrypts a file.
-func (bx *Box) Decrypt(names []string, overwrite bool, bulkpause bool, setgroup string) error {
+// catRevision returns the plaintext of the file key as of revision rev.
+func catRevision(bx *Box, key, rev string) ([]byte, error) {
+	vkey := key
+	if _, ok := bx.FilesSet[key]; ok {
+		var err error
+		vkey, err = bx.versionedName(key)
+		if err != nil {
+			return nil, err
+		}
+	}
+	data, err := bx.Vcs.CatRevision(bx.RepoBaseDir, rev, vkey)
+	if err != nil {
+		return nil, err
+	}
+	return bx.plaintext(data)
+}
+
+// Decrypt decrypts a file. It reports whether each file is new, changed
+// or unchanged; with changedOnly, unchanged files are not listed. With
+// quiet, nothing is reported; the caller outputs the summary instead.
+// The summary is nil if no file was tried.
+func (bx *Box) Decrypt(names []string, overwrite bool, bulkpause bool, setgroup string, changedOnly, quiet bool) (*DecryptSummary, error) {
 	var err error
 
 	if err := anyGpg(names); err != nil {
-		return err
+		return nil, err
+	}
+	if err := bx.notInFilterMode("decrypt"); err != nil {
+		return nil, err
 	}
 
 	err = bx.getFiles()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if bulkpause {
@@ -121,67 +269,234 @@ func (bx *Box) Decrypt(names []string, overwrite bool, bulkpause bool, setgroup
 	if setgroup != "" {
 		gid, err = parseGroup(setgroup)
 		if err != nil {
-			return fmt.Errorf("Invalid group name or gid: %w", err)
+			return nil, fmt.Errorf("Invalid group name or gid: %w", err)
 		}
 		groupchange = true
 	}
 	bx.logDebug.Printf("DECRYPT GROUP %q %v,%v\n", setgroup, groupchange, gid)
 
-	if len(names) == 0 {
-		names = bx.Files
+	keys, err := bx.keys(names)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		keys = bx.Files
+	}
+
+	report := reportAll
+	switch {
+	case quiet:
+		report = reportNone
+	case changedOnly:
+		report = reportChanged
 	}
-	return decryptMany(bx, names, overwrite, groupchange, gid)
+	return decryptMany(bx, keys, overwrite, groupchange, gid, report)
 }
 
-func decryptMany(bx *Box, names []string, overwrite bool, groupchange bool, gid int) error {
+// DecryptSummary lists what happened to each file, by name.
+type DecryptSummary struct {
+	Repo      string   `json:"repo,omitempty"` // The repo's base directory (only with --recursive).
+	New       []string `json:"new"`            // There was no plaintext.
+	Changed   []string `json:"changed"`        // The plaintext was overwritten with a new version.
+	Unchanged []string `json:"unchanged"`      // The plaintext was already up to date.
+	Skipped   []string `json:"skipped"`        // Not registered, or the plaintext exists (without --overwrite).
+	Failed    []string `json:"failed"`         // Could not be decrypted.
+}
 
-	// TODO(tlim): If we want to decrypt them in parallel, go has a helper function
-	// called "sync.WaitGroup()"" which would be useful here.  We would probably
-	// want to add a flag on the command line (stored in a field such as bx.ParallelMax)
-	// that limits the amount of parallelism. The default for the flag should
-	// probably be runtime.NumCPU().
+// What decryptMany reports.
+const (
+	reportAll     = iota // Each file.
+	reportChanged        // New and changed files.
+	reportNone
+)
 
-	for _, name := range names {
-		fmt.Printf("========== DECRYPTING %q\n", name)
-		if !bx.FilesSet[name] {
+func decryptMany(bx *Box, keys []string, overwrite bool, groupchange bool, gid int, report int) (*DecryptSummary, error) {
+	summary := &DecryptSummary{
+		New:       []string{},
+		Changed:   []string{},
+		Unchanged: []string{},
+		Skipped:   []string{},
+		Failed:    []string{},
+	}
+
+	var names []string
+	for _, key := range keys {
+		name := bx.path(key)
+		if !bx.FilesSet[key] {
 			bx.logErr.Printf("Skipping %q: File not registered with Blackbox", name)
+			summary.Skipped = append(summary.Skipped, name)
 			continue
 		}
 		if (!overwrite) && bbutil.FileExistsOrProblem(name) {
 			bx.logErr.Printf("Skipping %q: Will not overwrite existing file", name)
+			summary.Skipped = append(summary.Skipped, name)
 			continue
 		}
+		names = append(names, name)
+	}
+
+	// TODO(tlim) v1 detects zero-length files and removes them, even
+	// if overwrite is disabled. I don't think anyone has ever used that
+	// feature. That said, if we want to do that, we would implement it here.
 
-		// TODO(tlim) v1 detects zero-length files and removes them, even
-		// if overwrite is disabled. I don't think anyone has ever used that
-		// feature. That said, if we want to do that, we would implement it here.
+	statuses := make([]string, len(names))
+	errs := bbutil.Parallel(bx.Parallel, len(names), os.Stdout, func(i int, out io.Writer) error {
+		name := names[i]
 
-		// TODO(tlim) v1 takes the md5 hash of the plaintext before it decrypts,
-		// then compares the new plaintext's md5. It prints "EXTRACTED" if
-		// there is a change.
+		// Like v1, hash the plaintext before and after, to report
+		// whether it changed.
+		before, existed := fileHash(name)
 
 		err := bx.Crypter.Decrypt(name, bx.Umask, overwrite)
 		if err != nil {
-			bx.logErr.Printf("%q: %v", name, err)
-			continue
+			return err
+		}
+
+		after, _ := fileHash(name)
+		if bx.DryRun {
+			// Nothing was written. Compare with what would have been.
+			data, err := bx.Crypter.Cat(name)
+			if err == nil {
+				data, err = bx.plaintext(data)
+			}
+			if err != nil {
+				return err
+			}
+			after = sha256.Sum256(data)
+		}
+		switch {
+		case !existed:
+			statuses[i] = "new"
+		case before != after:
+			statuses[i] = "changed"
+		default:
+			statuses[i] = "unchanged"
+		}
+		if report == reportAll || (report == reportChanged && statuses[i] != "unchanged") {
+			fmt.Fprintf(out, "========== DECRYPTED (%s) %q\n", statuses[i], name)
 		}
 
 		// FIXME(tlim): Clone the file perms from the .gpg file to the plaintext file.
 
 		if groupchange {
 			// FIXME(tlim): Also "chmod g+r" the file.
-			os.Chown(name, -1, gid)
+			if err := bx.chown(name, gid); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	for i, name := range names {
+		switch {
+		case errs[i] != nil:
+			bx.logErr.Printf("%q: %v", name, errs[i])
+			summary.Failed = append(summary.Failed, name)
+		case statuses[i] == "new":
+			summary.New = append(summary.New, name)
+		case statuses[i] == "changed":
+			summary.Changed = append(summary.Changed, name)
+		default:
+			summary.Unchanged = append(summary.Unchanged, name)
+		}
+	}
+	return summary, failures("decrypt", summary.Failed)
+}
+
+// failures returns an error that lists the files that verb failed for,
+// or nil if there are none.
+func failures(verb string, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s failed for %d file(s): %s",
+		verb, len(names), makesafe.FirstFew(makesafe.ShellMany(names)))
+}
+
+// Deploy decrypts all files, overwriting any plaintext, for use on
+// production hosts (i.e. by Puppet or Ansible). It never prompts. Each
+// plaintext gets the permissions of its .gpg file and, if setgroup is
+// set, that group with g+r. It fails if any file could not be decrypted.
+func (bx *Box) Deploy(setgroup string) error {
+	if err := bx.notInFilterMode("deploy"); err != nil {
+		return err
+	}
+
+	// Since this is often run in a security-critical situation, gpg is
+	// run with a safe PATH, a minimal environment and no stdin.
+	bbutil.Harden()
+
+	gid := -1
+	if setgroup != "" {
+		var err error
+		gid, err = parseGroup(setgroup)
+		if err != nil {
+			return fmt.Errorf("Invalid group name or gid: %w", err)
+		}
+	}
+
+	err := bx.getFiles()
+	if err != nil {
+		return err
+	}
+
+	names := bx.paths(bx.Files)
+	errs := bbutil.Parallel(bx.Parallel, len(names), os.Stdout, func(i int, out io.Writer) error {
+		fmt.Fprintf(out, "========== DEPLOYING %q\n", names[i])
+		return deployFile(bx, names[i], gid)
+	})
+	var failed []string
+	for i, err := range errs {
+		if err != nil {
+			bx.logErr.Printf("%q: %v", names[i], err)
+			failed = append(failed, names[i])
 		}
 	}
+
+	fmt.Printf("========== DEPLOYED: %d files, %d failed\n", len(bx.Files), len(failed))
+	for _, name := range failed {
+		fmt.Printf("FAILED: %s\n", name)
+	}
+	if len(failed) != 0 {
+		return fmt.Errorf("deploy: %d of %d files failed", len(failed), len(bx.Files))
+	}
 	return nil
 }
 
+// deployFile decrypts name, overwriting it, and gives it the
+// permissions of name.gpg. If gid != -1 the file is changed to that
+// group and made group-readable.
+func deployFile(bx *Box, name string, gid int) error {
+	fi, err := os.Stat(name + ".gpg")
+	if err != nil {
+		return err
+	}
+	err = bx.Crypter.Decrypt(name, bx.Umask, true)
+	if err != nil {
+		return err
+	}
+	mode := fi.Mode().Perm()
+	if gid != -1 {
+		if err := bx.chown(name, gid); err != nil {
+			return err
+		}
+		mode |= 0o040
+	}
+	if bx.DryRun {
+		bbutil.DryRunf("would chmod %q to %04o", name, mode)
+		return nil
+	}
+	return os.Chmod(name, mode)
+}
+
 // Diff ...
 func (bx *Box) Diff([]string) error {
 	return fmt.Errorf("NOT IMPLEMENTED: Diff")
 }
 
-// Edit unencrypts, calls editor, calls encrypt.
+// Edit decrypts each file into a private temp file, runs the editor on
+// it, and re-encrypts it if it was changed. The temp file is then
+// shredded. The plaintext is never written into the repo.
 func (bx *Box) Edit(names []string) error {
 
 	if err := anyGpg(names); err != nil {
@@ -192,22 +507,138 @@ func (bx *Box) Edit(names []string) error {
 	if err != nil {
 		return err
 	}
+	editor, err := bbutil.ShellWords(bx.Editor)
+	if err != nil {
+		return fmt.Errorf("editor: %w", err)
+	}
+	if len(editor) == 0 {
+		return fmt.Errorf("no editor (set $EDITOR or --editor)")
+	}
 
-	for _, name := range names {
-		if _, ok := bx.FilesSet[name]; ok {
-			if !bbutil.FileExistsOrProblem(name) {
-				err := bx.Crypter.Decrypt(name, bx.Umask, false)
-				if err != nil {
-					return fmt.Errorf("edit failed %q: %w", name, err)
-				}
+	keys, err := bx.keys(names)
+	if err != nil {
+		return err
+	}
+	for i, key := range keys {
+		if !bx.FilesSet[key] {
+			return fmt.Errorf("file %q is not registered", names[i])
+		}
+	}
+
+	filter, err := bx.isFilterMode()
+	if err != nil {
+		return err
+	}
+	if filter {
+		// The plaintext is in the working tree already. The VCS
+		// encrypts it when it is committed.
+		for _, key := range keys {
+			if _, err := bx.runEditor(editor, bx.path(key), key); err != nil {
+				return fmt.Errorf("%w (the file was not fixed)", err)
 			}
 		}
-		err := bbutil.RunBash(bx.Editor, name)
+		bx.Vcs.NeedsCommit(
+			PrettyCommitMessage("EDITED", keys),
+			bx.RepoBaseDir,
+			bx.paths(keys),
+		)
+		return nil
+	}
+
+	var edited, enames []string
+	for _, key := range keys {
+		var ename string
+		ename, err = bx.editOne(editor, key)
 		if err != nil {
-			return err
+			break // Still commit the files that were edited.
+		}
+		if ename != "" {
+			edited = append(edited, key)
+			enames = append(enames, ename)
+		}
+	}
+
+	if len(edited) != 0 {
+		bx.Vcs.NeedsCommit(
+			PrettyCommitMessage("EDITED", edited),
+			bx.RepoBaseDir,
+			enames,
+		)
+	}
+	return err
+}
+
+// editOne runs the editor on a temp copy of the registered file key and
+// re-encrypts it if it was changed. It returns the name of the .gpg file
+// it wrote, or "" if there were no changes.
+func (bx *Box) editOne(editor []string, key string) (string, error) {
+	name := bx.path(key)
+
+	data, err := bx.Crypter.Cat(name)
+	if err != nil {
+		return "", fmt.Errorf("edit failed %q: %w", name, err)
+	}
+	if bbutil.FileExistsOrProblem(name) {
+		// Don't silently lose edits that were made to the decrypted file.
+		plain, err := ioutil.ReadFile(name)
+		if err != nil {
+			return "", err
+		}
+		if !bytes.Equal(plain, data) {
+			return "", fmt.Errorf("%q has changes that are not encrypted. Run \"blackbox encrypt\" or \"blackbox shred\" first", name)
+		}
+	}
+
+	tmpname, cleanup, err := privateTemp(filepath.Base(name), data)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	after, err := bx.runEditor(editor, tmpname, key)
+	if err != nil {
+		return "", fmt.Errorf("%w (not encrypted; the changes were discarded)", err)
+	}
+
+	if bytes.Equal(after, data) {
+		fmt.Printf("========== UNCHANGED %q\n", name)
+		return "", nil
+	}
+	fmt.Printf("========== ENCRYPTING %q\n", name)
+	ename, err := bx.writeEncrypted(key, after)
+	if err != nil {
+		return "", err
+	}
+	if bbutil.FileExistsOrProblem(name) {
+		// It was the same as the old version. Keep it in sync.
+		if err := bx.writeFile(name, after, 0o600); err != nil {
+			return "", err
+		}
+	}
+	return ename, nil
+}
+
+// runEditor runs the editor on filename, the plaintext of the registered
+// file key, and returns its new contents. If they are not valid, the
+// user may edit them again.
+func (bx *Box) runEditor(editor []string, filename, key string) ([]byte, error) {
+	for {
+		err := bbutil.RunBash(editor[0], append(editor[1:], filename)...)
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		err = bx.validate(key, data)
+		if err == nil {
+			return data, nil
+		}
+		if !askReedit(err) {
+			return nil, err
 		}
 	}
-	return nil
 }
 
 // Encrypt encrypts a file.
@@ -217,6 +648,9 @@ func (bx *Box) Encrypt(names []string, shred bool) error {
 	if err = anyGpg(names); err != nil {
 		return err
 	}
+	if err := bx.notInFilterMode("encrypt"); err != nil {
+		return err
+	}
 
 	err = bx.getAdmins()
 	if err != nil {
@@ -227,26 +661,51 @@ func (bx *Box) Encrypt(names []string, shred bool) error {
 	if err != nil {
 		return err
 	}
-	if len(names) == 0 {
-		names = bx.Files
+	keys, err := bx.keys(names)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		keys = bx.Files
+	}
+
+	// Don't encrypt files that are not valid.
+	var valid []string
+	invalid := 0
+	for _, key := range keys {
+		data, err := ioutil.ReadFile(bx.path(key))
+		if err == nil {
+			err = bx.validate(key, data)
+		} else if os.IsNotExist(err) {
+			err = nil // encryptMany reports this.
+		}
+		if err != nil {
+			bx.logErr.Printf("Not encrypting: %v", err)
+			invalid++
+			continue
+		}
+		valid = append(valid, key)
 	}
 
-	enames, err := encryptMany(bx, names, shred)
+	enames, err := encryptMany(bx, valid, shred)
 
 	bx.Vcs.NeedsCommit(
-		PrettyCommitMessage("ENCRYPTED", names),
+		PrettyCommitMessage("ENCRYPTED", valid),
 		bx.RepoBaseDir,
 		enames,
 	)
 
+	if err == nil && invalid != 0 {
+		err = fmt.Errorf("%d file(s) failed validation and were not encrypted", invalid)
+	}
 	return err
 }
 
-func encryptMany(bx *Box, names []string, shred bool) ([]string, error) {
-	var enames []string
-	for _, name := range names {
-		fmt.Printf("========== ENCRYPTING %q\n", name)
-		if !bx.FilesSet[name] {
+func encryptMany(bx *Box, keys []string, shred bool) ([]string, error) {
+	var names []string
+	for _, key := range keys {
+		name := bx.path(key)
+		if !bx.FilesSet[key] {
 			bx.logErr.Printf("Skipping %q: File not registered with Blackbox", name)
 			continue
 		}
@@ -254,18 +713,119 @@ func encryptMany(bx *Box, names []string, shred bool) ([]string, error) {
 			bx.logErr.Printf("Skipping. Plaintext does not exist: %q", name)
 			continue
 		}
-		ename, err := bx.Crypter.Encrypt(name, bx.Umask, bx.Admins)
+		names = append(names, name)
+	}
+
+	enames := make([]string, len(names))
+	errs := bbutil.Parallel(bx.Parallel, len(names), os.Stdout, func(i int, out io.Writer) error {
+		fmt.Fprintf(out, "========== ENCRYPTING %q\n", names[i])
+		var err error
+		enames[i], err = bx.Crypter.Encrypt(names[i], bx.Umask, bx.Admins)
+		return err
+	})
+
+	var done, encrypted, failed []string
+	for i, err := range errs {
 		if err != nil {
-			bx.logErr.Printf("Failed to encrypt %q: %v", name, err)
+			bx.logErr.Printf("Failed to encrypt %q: %v", names[i], err)
+			failed = append(failed, names[i])
 			continue
 		}
-		enames = append(enames, ename)
-		if shred {
-			bx.Shred([]string{name})
+		done = append(done, names[i])
+		encrypted = append(encrypted, enames[i])
+	}
+	if shred {
+		bbutil.ShredFiles(done, bx.Parallel, bx.DryRun)
+	}
+
+	return encrypted, failures("encrypt", failed)
+}
+
+// Exec runs command with secrets. The variables set by the dotenv-style
+// files envFiles are added to its environment. For each NAME=file in
+// fileEnvs, $NAME is the name of a pipe (/dev/fd/N) from which command
+// can read the plaintext of file, once. The files are decrypted in
+// memory; plaintext is never written to disk.
+func (bx *Box) Exec(envFiles, fileEnvs []string, command []string) error {
+	if len(command) == 0 {
+		return fmt.Errorf("exec: no command given")
+	}
+	if len(fileEnvs) != 0 && runtime.GOOS == "windows" {
+		return fmt.Errorf("exec: --file-as-env is not supported on Windows")
+	}
+
+	env := os.Environ()
+	for _, name := range envFiles {
+		data, err := bx.secret(name)
+		if err != nil {
+			return fmt.Errorf("exec: %w", err)
+		}
+		vars, err := dotenv.Parse(data)
+		if err != nil {
+			return fmt.Errorf("exec: %q: %w", name, err)
+		}
+		for _, v := range vars {
+			env = append(env, v.Name+"="+v.Value)
+		}
+	}
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	type pipe struct {
+		r, w *os.File
+		data []byte
+	}
+	var pipes []pipe
+	defer func() {
+		for _, p := range pipes {
+			p.r.Close()
+		}
+	}()
+	for _, fe := range fileEnvs {
+		i := strings.IndexByte(fe, '=')
+		if i < 1 {
+			return fmt.Errorf("exec: --file-as-env %q: expected NAME=file", fe)
+		}
+		data, err := bx.secret(fe[i+1:])
+		if err != nil {
+			return fmt.Errorf("exec: %w", err)
+		}
+		r, w, err := os.Pipe()
+		if err != nil {
+			return fmt.Errorf("exec: %w", err)
+		}
+		pipes = append(pipes, pipe{r, w, data})
+		cmd.ExtraFiles = append(cmd.ExtraFiles, r)
+		// ExtraFiles start at fd 3.
+		env = append(env, fmt.Sprintf("%s=/dev/fd/%d", fe[:i], 2+len(cmd.ExtraFiles)))
+	}
+	cmd.Env = env
+
+	err := cmd.Start()
+	if err != nil {
+		for _, p := range pipes {
+			p.w.Close()
 		}
+		return fmt.Errorf("exec: %w", err)
+	}
+	for _, p := range pipes {
+		go func(w *os.File, data []byte) {
+			w.Write(data) // Fails if the child exits without reading. That's ok.
+			w.Close()
+		}(p.w, p.data)
 	}
 
-	return enames, nil
+	// Pass signals (i.e. CTRL-C) on to the child, and wait for it.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	go func() {
+		for s := range sigs {
+			cmd.Process.Signal(s)
+		}
+	}()
+	return cmd.Wait()
 }
 
 // FileAdd enrolls files.
@@ -276,10 +836,8 @@ func (bx *Box) FileAdd(names []string, shred bool) error {
 	// Encrypt them all.
 	// If that succeeds, add to the blackbox-files.txt file.
 	// (optionally) shred the plaintext.
-
-	// FIXME(tlim): Check if the plaintext is in GIT.  If it is,
-	// remove it from Git and print a warning that they should
-	// eliminate the history or rotate any secrets.
+	// If the plaintext is in the VCS, untrack it and warn that
+	// the secret has leaked.
 
 	if err := anyGpg(names); err != nil {
 		return err
@@ -293,80 +851,545 @@ func (bx *Box) FileAdd(names []string, shred bool) error {
 	if err != nil {
 		return err
 	}
-	if err := anyGpg(names); err != nil {
+	keys, err := bx.keys(names)
+	if err != nil {
 		return err
 	}
 
 	// Check for newlines
-	for _, n := range names {
+	for _, n := range keys {
 		if strings.ContainsAny(n, "\n") {
 			return fmt.Errorf("file %q contains a newlineregistered", n)
 		}
 	}
 
 	// Check for duplicates.
-	for _, n := range names {
-		if i := sort.SearchStrings(bx.Files, n); i < len(bx.Files) && bx.Files[i] == n {
+	for _, n := range keys {
+		if bx.FilesSet[n] {
 			return fmt.Errorf("file %q already registered", n)
 		}
 	}
 
-	// Encrypt
-	var needsCommit []string
-	for _, name := range names {
-		s, err := bx.Crypter.Encrypt(name, bx.Umask, bx.Admins)
+	// Check that they are valid.
+	for _, key := range keys {
+		data, err := ioutil.ReadFile(bx.path(key))
 		if err != nil {
-			return fmt.Errorf("AdminAdd failed AddNewKey: %v", err)
+			return err
 		}
-		needsCommit = append(needsCommit, s)
-	}
+		if err := bx.validate(key, data); err != nil {
+			return err
+		}
+	}
 
-	// TODO(tlim): Try the json file.
+	filter, err := bx.isFilterMode()
+	if err != nil {
+		return err
+	}
+	if filter {
+		return fileAddFilter(bx, keys)
+	}
 
-	// Try the legacy file:
-	fn := filepath.Join(bx.ConfigPath, "blackbox-files.txt")
-	bx.logDebug.Printf("Files file: %q", fn)
-	err = bbutil.AddLinesToSortedFile(fn, names...)
+	// Encrypt
+	var needsCommit []string
+	for _, name := range bx.paths(keys) {
+		s, err := bx.Crypter.Encrypt(name, bx.Umask, bx.Admins)
+		if err != nil {
+			return fmt.Errorf("AdminAdd failed AddNewKey: %v", err)
+		}
+		needsCommit = append(needsCommit, s)
+	}
+
+	fn, err := bx.putFiles(append(bx.Files, keys...))
 	if err != nil {
-		return fmt.Errorf("could not update file (%q,%q): %v", fn, names, err)
+		return err
 	}
 
-	err = bx.Shred(names)
+	err = bx.Shred(bx.paths(keys))
 	if err != nil {
 		bx.logErr.Printf("Error while shredding: %v", err)
 	}
 
-	bx.Vcs.CommitTitle("BLACKBOX ADD FILE: " + makesafe.FirstFew(makesafe.ShellMany(names)))
+	bx.Vcs.CommitTitle("BLACKBOX ADD FILE: " + makesafe.FirstFew(makesafe.ShellMany(keys)))
 
-	bx.Vcs.IgnoreFiles(bx.RepoBaseDir, names)
+	err = bx.setDrivers()
+	if err != nil {
+		return err
+	}
+	err = bx.syncVcs()
+	if err != nil {
+		return err
+	}
 
 	bx.Vcs.NeedsCommit(
-		PrettyCommitMessage("blackbox-files.txt add", names),
+		PrettyCommitMessage("blackbox-files.txt add", keys),
 		bx.RepoBaseDir,
-		append([]string{filepath.Join(bx.ConfigPath, "blackbox-files.txt")}, needsCommit...),
+		append([]string{fn}, needsCommit...),
 	)
+
+	return untrackPlaintext(bx, keys)
+}
+
+// fileAddFilter enrolls files in ModeFilter. The plaintext stays where it
+// is. The VCS encrypts it when it is checked in.
+func fileAddFilter(bx *Box, keys []string) error {
+	for _, name := range bx.paths(keys) {
+		if !bbutil.FileExistsOrProblem(name) {
+			return fmt.Errorf("file %q does not exist", name)
+		}
+	}
+
+	fn, err := bx.putFiles(append(bx.Files, keys...))
+	if err != nil {
+		return err
+	}
+
+	bx.Vcs.CommitTitle("BLACKBOX ADD FILE: " + makesafe.FirstFew(makesafe.ShellMany(keys)))
+
+	err = bx.setDrivers()
+	if err != nil {
+		return err
+	}
+	err = bx.syncVcs()
+	if err != nil {
+		return err
+	}
+
+	// If the plaintext was already checked in, this untracks it so that
+	// the commit below checks it in again, this time encrypted.
+	err = untrackPlaintext(bx, keys)
+	if err != nil {
+		return err
+	}
+
+	bx.Vcs.NeedsCommit(
+		PrettyCommitMessage("blackbox-files.txt add", keys),
+		bx.RepoBaseDir,
+		append([]string{fn}, bx.paths(keys)...),
+	)
+	return nil
+}
+
+// untrackPlaintext queues removing plaintext from the VCS and warns about any
+// plaintext found in the VCS history.
+func untrackPlaintext(bx *Box, keys []string) error {
+	var untrack []string
+	for _, name := range keys {
+		tracked, commits, err := bx.Vcs.FileHistory(bx.RepoBaseDir, name)
+		if err != nil {
+			return err
+		}
+		if tracked {
+			untrack = append(untrack, name)
+		}
+		if !tracked && len(commits) == 0 {
+			continue
+		}
+
+		bx.logErr.Printf("")
+		bx.logErr.Printf("========== WARNING! WARNING! WARNING!")
+		bx.logErr.Printf("========== The plaintext of %q is in %s.", name, bx.Vcs.Name())
+		bx.logErr.Printf("========== Encrypting it now does NOT remove it from history.")
+		bx.logErr.Printf("========== Consider this secret LEAKED. ROTATE IT (change the")
+		bx.logErr.Printf("========== passwords, keys, etc.) and, if possible, scrub the history.")
+		if tracked {
+			bx.logErr.Printf("========== It will be removed from the index. Commit that change soon.")
+		}
+		if len(commits) != 0 {
+			bx.logErr.Printf("========== It is found in these commits:")
+			for _, c := range commits {
+				bx.logErr.Printf("    %s", c)
+			}
+		}
+		bx.logErr.Printf("")
+	}
+	bx.Vcs.NeedsUntrack(PrettyCommitMessage("untrack", untrack), bx.RepoBaseDir, untrack)
 	return nil
 }
 
-// FileList lists the files.
-func (bx *Box) FileList() error {
+// File is a registered file.
+type File struct {
+	Name string `json:"name"` // Relative to the current directory.
+}
+
+// FileList lists the registered files.
+func (bx *Box) FileList() ([]File, error) {
 	err := bx.getFiles()
 	if err != nil {
+		return nil, err
+	}
+	files := make([]File, len(bx.Files))
+	for i, v := range bx.paths(bx.Files) {
+		files[i] = File{Name: v}
+	}
+	return files, nil
+}
+
+// FileMove renames a registered file. The VCS is told of the rename
+// so that the history of the encrypted file follows it. The plaintext,
+// if any, is moved too.
+func (bx *Box) FileMove(oldname, newname string) error {
+	if err := anyGpg([]string{oldname, newname}); err != nil {
 		return err
 	}
-	for _, v := range bx.Files {
-		fmt.Println(v)
+	err := bx.getFiles()
+	if err != nil {
+		return err
 	}
+	oldkey, err := bx.key(oldname)
+	if err != nil {
+		return err
+	}
+	newkey, err := bx.key(newname)
+	if err != nil {
+		return err
+	}
+	if strings.ContainsAny(newkey, "\n") {
+		return fmt.Errorf("file %q contains a newline", newkey)
+	}
+	if !bx.FilesSet[oldkey] {
+		return fmt.Errorf("file %q is not registered", bx.path(oldkey))
+	}
+	if bx.FilesSet[newkey] {
+		return fmt.Errorf("file %q already registered", bx.path(newkey))
+	}
+	oldv, err := bx.versionedName(oldkey)
+	if err != nil {
+		return err
+	}
+	newv, err := bx.versionedName(newkey)
+	if err != nil {
+		return err
+	}
+
+	// Check everything before changing anything.
+	moveplain := oldv != oldkey && bbutil.FileExistsOrProblem(bx.path(oldkey))
+	for _, key := range []string{newkey, newv} {
+		if bbutil.FileExistsOrProblem(bx.path(key)) {
+			return fmt.Errorf("file %q exists", bx.path(key))
+		}
+	}
+
+	err = bx.Vcs.Rename(bx.RepoBaseDir, oldv, newv)
+	if err != nil {
+		return err
+	}
+	if moveplain {
+		// The plaintext is ignored by the VCS. Move it ourselves.
+		if bx.DryRun {
+			bbutil.DryRunf("would move %q to %q", bx.path(oldkey), bx.path(newkey))
+		} else {
+			err = os.Rename(bx.path(oldkey), bx.path(newkey))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	var rest []string
+	for _, key := range bx.Files {
+		if key != oldkey {
+			rest = append(rest, key)
+		}
+	}
+	fn, err := bx.putFiles(append(rest, newkey))
+	if err != nil {
+		return err
+	}
+
+	bx.Vcs.CommitTitle("BLACKBOX RENAME FILE: " + makesafe.FirstFew(makesafe.ShellMany([]string{oldkey, newkey})))
+
+	err = bx.syncVcs()
+	if err != nil {
+		return err
+	}
+
+	bx.Vcs.NeedsCommit(
+		PrettyCommitMessage("blackbox-files.txt rename", []string{oldkey, newkey}),
+		bx.RepoBaseDir,
+		[]string{fn, bx.path(oldv), bx.path(newv)},
+	)
 	return nil
 }
 
-// FileRemove de-enrolls files.
+// FileRemove de-enrolls files. The encrypted file is removed. The
+// plaintext is left as-is, and is no longer ignored by the VCS.
 func (bx *Box) FileRemove(names []string) error {
-	return fmt.Errorf("NOT IMPLEMENTED: FileRemove")
+	err := bx.getFiles()
+	if err != nil {
+		return err
+	}
+	keys, err := bx.keys(names)
+	if err != nil {
+		return err
+	}
+	remove := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if !bx.FilesSet[key] {
+			return fmt.Errorf("file %q is not registered", bx.path(key))
+		}
+		remove[key] = true
+	}
+	filter, err := bx.isFilterMode()
+	if err != nil {
+		return err
+	}
+
+	var rest []string
+	for _, key := range bx.Files {
+		if !remove[key] {
+			rest = append(rest, key)
+		}
+	}
+	fn, err := bx.putFiles(rest)
+	if err != nil {
+		return err
+	}
+
+	bx.Vcs.CommitTitle("BLACKBOX REMOVE FILE: " + makesafe.FirstFew(makesafe.ShellMany(keys)))
+
+	needsCommit := []string{fn}
+	if filter {
+		// The VCS has the encrypted version. Stop tracking it so that
+		// the plaintext isn't checked in by accident.
+		bx.Vcs.NeedsUntrack(PrettyCommitMessage("untrack", keys), bx.RepoBaseDir, keys)
+		for _, name := range bx.paths(keys) {
+			bx.logErr.Printf("WARNING: %q is no longer encrypted by the VCS. Do not check it in.", name)
+		}
+	} else {
+		var gpgkeys []string
+		for _, key := range keys {
+			gpgkeys = append(gpgkeys, key+".gpg")
+		}
+		err = bx.Vcs.Remove(bx.RepoBaseDir, gpgkeys)
+		if err != nil {
+			return err
+		}
+		needsCommit = append(needsCommit, bx.paths(gpgkeys)...)
+	}
+
+	err = bx.syncVcs()
+	if err != nil {
+		return err
+	}
+
+	bx.Vcs.NeedsCommit(
+		PrettyCommitMessage("blackbox-files.txt remove", keys),
+		bx.RepoBaseDir,
+		needsCommit,
+	)
+	return nil
+}
+
+// FilterClean reads plaintext on stdin and outputs it encrypted. The VCS
+// calls this when checking in a file (ModeFilter). name is the path of
+// the file relative to the repo base (or "" if unknown).
+func (bx *Box) FilterClean(name string) error {
+	plaintext, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return fmt.Errorf("filter clean: %w", err)
+	}
+	if bx.Crypter.IsEncrypted(plaintext) {
+		// Never encrypt twice.
+		_, err = os.Stdout.Write(plaintext)
+		return err
+	}
+
+	// Encryption isn't deterministic. If the staged version decrypts to
+	// the same plaintext, output it instead. Otherwise the VCS would report
+	// the file as modified every time it looks at it.
+	if name != "" {
+		old, err := bx.Vcs.CatStaged(bx.RepoBaseDir, name)
+		if err == nil && bx.Crypter.IsEncrypted(old) {
+			p, err := bx.Crypter.DecryptBytes(old)
+			if err == nil && bytes.Equal(p, plaintext) {
+				_, err = os.Stdout.Write(old)
+				return err
+			}
+		}
+	}
+
+	if err := bx.getAdmins(); err != nil {
+		return err
+	}
+	ciphertext, err := bx.Crypter.EncryptBytes(plaintext, bx.Admins)
+	if err != nil {
+		return fmt.Errorf("filter clean %q: %w", name, err)
+	}
+	_, err = os.Stdout.Write(ciphertext)
+	return err
+}
+
+// FilterInstall puts the repo in ModeFilter (if it isn't already) and
+// configures the VCS to use the clean/smudge filter. Each user must run
+// this once per checkout.
+func (bx *Box) FilterInstall() error {
+	if err := bx.getConfig(); err != nil {
+		return err
+	}
+	if err := bx.getFiles(); err != nil {
+		return err
+	}
+
+	if bx.Config.Mode != ModeFilter {
+		if len(bx.Files) != 0 {
+			return fmt.Errorf("can not switch to filter mode: files are already registered")
+		}
+		bx.Config.Mode = ModeFilter
+		fn, err := bx.putConfig()
+		if err != nil {
+			return err
+		}
+		bx.Vcs.NeedsCommit("blackbox mode: filter", bx.RepoBaseDir, []string{fn})
+	}
+
+	err := bx.setDrivers()
+	if err != nil {
+		return err
+	}
+	err = bx.syncVcs()
+	if err != nil {
+		return err
+	}
+
+	// Files checked out before the filter was configured are still
+	// encrypted. Decrypt them in place.
+	for _, name := range bx.paths(bx.Files) {
+		data, err := ioutil.ReadFile(name)
+		if err != nil || !bx.Crypter.IsEncrypted(data) {
+			continue
+		}
+		fmt.Printf("========== DECRYPTING %q\n", name)
+		plaintext, err := bx.Crypter.DecryptBytes(data)
+		if err != nil {
+			bx.logErr.Printf("%q: %v", name, err)
+			continue
+		}
+		if err := bx.writeFile(name, plaintext, 0o666&^os.FileMode(bx.Umask)); err != nil {
+			bx.logErr.Printf("%q: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// FilterSmudge reads an encrypted file on stdin and outputs the
+// plaintext. The VCS calls this when checking out a file (ModeFilter).
+// If the file can't be decrypted (i.e. the user isn't an admin) the
+// ciphertext is output as-is.
+func (bx *Box) FilterSmudge(name string) error {
+	data, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return fmt.Errorf("filter smudge: %w", err)
+	}
+	if bx.Crypter.IsEncrypted(data) {
+		plaintext, err := bx.Crypter.DecryptBytes(data)
+		if err == nil {
+			data = plaintext
+		} else {
+			bx.logErr.Printf("Can not decrypt %q. Leaving it encrypted: %v", name, err)
+		}
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+// Get prints the value at path (i.e. "db.password") in the registered
+// YAML, JSON or dotenv file name. The file is decrypted in memory.
+func (bx *Box) Get(name, path string) error {
+	f, err := structured.FormatOf(name)
+	if err != nil {
+		return err
+	}
+	data, err := bx.secret(name)
+	if err != nil {
+		return err
+	}
+	v, err := structured.Get(f, data, path)
+	if err != nil {
+		return fmt.Errorf("%q: %w", name, err)
+	}
+	if !strings.HasSuffix(v, "\n") {
+		v += "\n"
+	}
+	fmt.Print(v)
+	return nil
+}
+
+// HooksInstall installs a VCS pre-commit hook that runs HooksPreCommit.
+func (bx *Box) HooksInstall() error {
+	return bx.Vcs.InstallPreCommitHook(bx.RepoBaseDir, bx.selfCommand()+" hooks pre-commit")
+}
+
+// HooksPreCommit refuses the commit if the plaintext of a registered file
+// is staged, or if a registered file's .gpg file isn't encrypted.
+// In ModeFilter the registered file itself must be encrypted.
+func (bx *Box) HooksPreCommit() error {
+	err := bx.getFiles()
+	if err != nil {
+		return err
+	}
+	filter, err := bx.isFilterMode()
+	if err != nil {
+		return err
+	}
+
+	staged, err := bx.Vcs.StagedFiles(bx.RepoBaseDir)
+	if err != nil {
+		return err
+	}
+
+	var refused []string
+	for _, sname := range staged {
+		// The VCS reports the names relative to the repo base, like keys.
+		name := sname
+
+		if bx.FilesSet[name] && !filter {
+			bx.logErr.Printf("REFUSED: %q is the plaintext of a registered file", sname)
+			refused = append(refused, sname)
+			continue
+		}
+
+		if filter && !bx.FilesSet[name] {
+			continue
+		}
+		if !filter && (!strings.HasSuffix(name, ".gpg") || !bx.FilesSet[strings.TrimSuffix(name, ".gpg")]) {
+			continue
+		}
+		data, err := bx.Vcs.CatStaged(bx.RepoBaseDir, sname)
+		if err != nil {
+			return err
+		}
+		if !bx.Crypter.IsEncrypted(data) {
+			bx.logErr.Printf("REFUSED: %q is not encrypted", sname)
+			refused = append(refused, sname)
+		}
+	}
+
+	if len(refused) != 0 {
+		return fmt.Errorf("blackbox pre-commit check failed. Unstage these files: %s",
+			strings.Join(makesafe.ShellMany(refused), " "))
+	}
+	return nil
+}
+
+// Info is what Info reports.
+type Info struct {
+	Debug       bool   `json:"debug"`
+	Team        string `json:"team"`
+	RepoBaseDir string `json:"repo_base_dir"`
+	ConfigPath  string `json:"config_path"`
+	Umask       string `json:"umask"` // Octal (i.e. "0027").
+	Editor      string `json:"editor"`
+	Parallel    int    `json:"parallel"`
+	DryRun      bool   `json:"dry_run"`
+	Shredder    string `json:"shredder"`
+	Admins      int    `json:"admins"` // How many.
+	Files       int    `json:"files"`  // How many.
+	Vcs         string `json:"vcs"`
+	Crypter     string `json:"crypter"`
 }
 
-// Info prints debugging info.
-func (bx *Box) Info() error {
+// Info reports debugging info.
+func (bx *Box) Info() (*Info, error) {
 
 	err := bx.getFiles()
 	if err != nil {
@@ -378,23 +1401,21 @@ func (bx *Box) Info() error {
 		bx.logErr.Printf("Info getAdmins: %v", err)
 	}
 
-	fmt.Println("BLACKBOX:")
-	fmt.Printf("          Debug: %v\n", bx.Debug)
-	fmt.Printf("           Team: %q\n", bx.Team)
-	fmt.Printf("    RepoBaseDir: %q\n", bx.RepoBaseDir)
-	fmt.Printf("     ConfigPath: %q\n", bx.ConfigPath)
-	fmt.Printf("          Umask: %04o\n", bx.Umask)
-	fmt.Printf("         Editor: %v\n", bx.Editor)
-	fmt.Printf("       Shredder: %v\n", bbutil.ShredInfo())
-	fmt.Printf("         Admins: count=%v\n", len(bx.Admins))
-	fmt.Printf("          Files: count=%v\n", len(bx.Files))
-	fmt.Printf("       FilesSet: count=%v\n", len(bx.FilesSet))
-	fmt.Printf("            Vcs: %v\n", bx.Vcs)
-	fmt.Printf("        VcsName: %q\n", bx.Vcs.Name())
-	fmt.Printf("        Crypter: %v\n", bx.Crypter)
-	fmt.Printf("    CrypterName: %q\n", bx.Crypter.Name())
-
-	return nil
+	return &Info{
+		Debug:       bx.Debug,
+		Team:        bx.Team,
+		RepoBaseDir: bx.RepoBaseDir,
+		ConfigPath:  bx.ConfigPath,
+		Umask:       fmt.Sprintf("%04o", bx.Umask),
+		Editor:      bx.Editor,
+		Parallel:    bx.Parallel,
+		DryRun:      bx.DryRun,
+		Shredder:    bbutil.ShredInfo(),
+		Admins:      len(bx.Admins),
+		Files:       len(bx.Files),
+		Vcs:         bx.Vcs.Name(),
+		Crypter:     bx.Crypter.Name(),
+	}, nil
 }
 
 // Init initializes a repo.
@@ -424,22 +1445,27 @@ func (bx *Box) Init(yes, vcsname string) error {
 		}
 	}
 
-	err := os.Mkdir(bx.ConfigPath, 0o750)
+	ba := filepath.Join(bx.ConfigPath, "blackbox-admins.txt")
+	bf := filepath.Join(bx.ConfigPath, "blackbox-files.txt")
+	if bx.DryRun {
+		bbutil.DryRunf("would create %q", bx.ConfigPath)
+		bbutil.DryRunf("would create %q", ba)
+		bbutil.DryRunf("would create %q", bf)
+	} else {
+		if err := os.Mkdir(bx.ConfigPath, 0o750); err != nil {
+			return err
+		}
+		bbutil.Touch(ba)
+		bbutil.Touch(bf)
+	}
+	err := bx.setDrivers()
+	if err != nil {
+		return err
+	}
+	err = bx.syncVcs()
 	if err != nil {
 		return err
 	}
-
-	ba := filepath.Join(bx.ConfigPath, "blackbox-admins.txt")
-	bf := filepath.Join(bx.ConfigPath, "blackbox-files.txt")
-	bbutil.Touch(ba)
-	bbutil.Touch(bf)
-	bx.Vcs.SetFileTypeUnix(bx.RepoBaseDir, ba, bf)
-
-	bx.Vcs.IgnoreAnywhere(bx.RepoBaseDir, []string{
-		"pubring.gpg~",
-		"pubring.kbx~",
-		"secring.gpg",
-	})
 
 	fs := []string{ba, bf}
 	bx.Vcs.NeedsCommit(
@@ -452,22 +1478,250 @@ func (bx *Box) Init(yes, vcsname string) error {
 	return nil
 }
 
-// Reencrypt decrypts and reencrypts files.
-func (bx *Box) Reencrypt(names []string, overwrite bool, bulkpause bool) error {
+// Log lists the commits that changed the encrypted version of name,
+// newest first. If patch is true, each commit is followed by a diff of
+// the decrypted file. If limit > 0, only that many commits are listed.
+func (bx *Box) Log(name string, patch bool, limit int) error {
+	if err := anyGpg([]string{name}); err != nil {
+		return fmt.Errorf("log: %w", err)
+	}
+
+	key, err := bx.key(name)
+	if err != nil {
+		return err
+	}
+	vkey, err := bx.versionedName(key)
+	if err != nil {
+		return err
+	}
+	versions, err := bx.Vcs.FileLog(bx.RepoBaseDir, vkey)
+	if err != nil {
+		return fmt.Errorf("log: %w", err)
+	}
+	if len(versions) == 0 {
+		return fmt.Errorf("log: %q has no history", name)
+	}
+	if limit > 0 && limit < len(versions) {
+		// Keep one more, to diff against.
+		versions = versions[:limit+1]
+	} else {
+		limit = len(versions)
+	}
+
+	// Each version is diffed against the one before it (the next in
+	// the list). The oldest is diffed against nothing.
+	var newer []byte
+	for i, v := range versions[:limit] {
+		fmt.Printf("commit %s\nAuthor: %s\nDate:   %s\n\n    %s\n\n", v.ID, v.Author, v.Date, v.Subject)
+		if !patch {
+			continue
+		}
+
+		if i == 0 {
+			newer, err = bx.logRevision(v)
+			if err != nil {
+				return err
+			}
+		}
+		var older []byte
+		aname := "/dev/null"
+		if i+1 < len(versions) {
+			older, err = bx.logRevision(versions[i+1])
+			if err != nil {
+				return err
+			}
+			aname = "a/" + strings.TrimSuffix(versions[i+1].Name, ".gpg")
+		}
+		fmt.Print(textdiff.Unified(aname, "b/"+strings.TrimSuffix(v.Name, ".gpg"),
+			textdiff.Lines(string(older)), textdiff.Lines(string(newer)), 3))
+		fmt.Println()
+		newer = older
+	}
+	return nil
+}
+
+// logRevision returns the plaintext of a version listed by Log. Versions
+// that can't be decrypted (i.e. the user wasn't an admin at the time)
+// are an error.
+func (bx *Box) logRevision(v models.FileVersion) ([]byte, error) {
+	data, err := bx.Vcs.CatRevision(bx.RepoBaseDir, v.ID, v.Name)
+	if err != nil {
+		return nil, fmt.Errorf("log: %w", err)
+	}
+	data, err = bx.plaintext(data)
+	if err != nil {
+		return nil, fmt.Errorf("log: can not decrypt %q as of %s: %w", v.Name, v.ID, err)
+	}
+	return data, nil
+}
+
+// MergeDriver does a three-way merge of the base, ours and theirs
+// versions of name (relative to the repo base), writing the result to
+// ours. The VCS calls this when merging registered files.
+//
+// The registry files get a sorted union merge. For other files, the
+// three versions are decrypted and merged. If the merge is clean,
+// the result is encrypted. If there are conflicts, ours is left as-is
+// and the merge (with conflict markers) is written to the plaintext
+// file, which the VCS ignores, unless the plaintext has changes that are
+// not in ours (which would be lost). In ModeFilter the merge (with conflict
+// markers) is written to ours, since the VCS never stores the working
+// file as-is.
+func (bx *Box) MergeDriver(base, ours, theirs, name string) error {
+	for _, r := range registryFiles {
+		key, err := bx.key(filepath.Join(bx.ConfigPath, r))
+		if err != nil {
+			return err
+		}
+		if key == filepath.ToSlash(name) {
+			return mergeRegistry(base, ours, theirs)
+		}
+	}
+	return mergeEncrypted(bx, base, ours, theirs, name)
+}
+
+// mergeRegistry merges sorted lists of names. Names added by either
+// side are kept. Names removed by either side are removed.
+func mergeRegistry(base, ours, theirs string) error {
+	var sets [3]map[string]bool
+	for i, fn := range []string{base, ours, theirs} {
+		lines, err := bbutil.ReadFileLines(fn)
+		if err != nil {
+			return fmt.Errorf("merge-driver: %w", err)
+		}
+		sets[i] = make(map[string]bool, len(lines))
+		for _, l := range lines {
+			sets[i][l] = true
+		}
+	}
+	b, o, t := sets[0], sets[1], sets[2]
+
+	var merged []string
+	for _, s := range []map[string]bool{o, t} {
+		for l := range s {
+			if b[l] && !(o[l] && t[l]) {
+				continue // Removed by the other side.
+			}
+			merged = append(merged, l)
+		}
+	}
+	sort.Strings(merged)
+	merged = dedup(merged)
+
+	contents := ""
+	if len(merged) != 0 {
+		contents = strings.Join(merged, "\n") + "\n"
+	}
+	return ioutil.WriteFile(ours, []byte(contents), 0o660)
+}
+
+// dedup removes adjacent duplicates from a sorted list.
+func dedup(l []string) []string {
+	var r []string
+	for i, s := range l {
+		if i == 0 || s != l[i-1] {
+			r = append(r, s)
+		}
+	}
+	return r
+}
+
+// mergeEncrypted merges the decrypted versions of name. See MergeDriver.
+func mergeEncrypted(bx *Box, base, ours, theirs, name string) error {
+	var lines [3][]string
+	var oursPlain []byte
+	for i, fn := range []string{base, ours, theirs} {
+		data, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return fmt.Errorf("merge-driver: %w", err)
+		}
+		data, err = bx.plaintext(data)
+		if err != nil {
+			return fmt.Errorf("merge-driver: can not decrypt %q: %w", name, err)
+		}
+		lines[i] = textdiff.Lines(string(data))
+		if i == 1 {
+			oursPlain = data
+		}
+	}
+
+	merged, conflicts := textdiff.Merge3(lines[0], lines[1], lines[2], "ours", "theirs")
+	plaintext := []byte(strings.Join(merged, ""))
+
+	if conflicts != 0 {
+		filter, err := bx.isFilterMode()
+		if err != nil {
+			return err
+		}
+		if filter {
+			if err := ioutil.WriteFile(ours, plaintext, 0o600); err != nil {
+				return err
+			}
+			return fmt.Errorf("merge-driver: %d conflict(s) in %q", conflicts, name)
+		}
+		pname := filepath.Join(bx.RepoBaseDir, strings.TrimSuffix(name, ".gpg"))
+		current, err := ioutil.ReadFile(pname)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("merge-driver: %w", err)
+		}
+		if err == nil && !bytes.Equal(current, oursPlain) {
+			return fmt.Errorf("merge-driver: %d conflict(s) in %q. The merge was not written to %q, which has changes that are not encrypted. Encrypt them (blackbox encrypt %s) or move them aside, then merge again",
+				conflicts, name, pname, makesafe.Shell(pname))
+		}
+		if err := ioutil.WriteFile(pname, plaintext, 0o666&^os.FileMode(bx.Umask)); err != nil {
+			return err
+		}
+		return fmt.Errorf("merge-driver: %d conflict(s) in %q. Resolve them in %q, then: blackbox encrypt %s",
+			conflicts, name, pname, makesafe.Shell(pname))
+	}
+
+	if err := bx.getAdmins(); err != nil {
+		return err
+	}
+	encrypted, err := bx.Crypter.EncryptBytes(plaintext, bx.Admins)
+	if err != nil {
+		return fmt.Errorf("merge-driver: can not encrypt %q: %w", name, err)
+	}
+	return ioutil.WriteFile(ours, encrypted, 0o660)
+}
+
+// MergeDriverInstall configures the VCS to use MergeDriver for the
+// registry files and registered files.
+func (bx *Box) MergeDriverInstall() error {
+	driver, command := bx.mergeDriver()
+	err := bx.Vcs.SetMergeDriver(bx.RepoBaseDir, driver, command)
+	if err != nil {
+		return err
+	}
+	return bx.syncVcs()
+}
+
+// Reencrypt re-encrypts files for the current admins (i.e. after one is
+// added or removed). Each file is decrypted and re-encrypted in memory;
+// plaintext is never written to disk, and any plaintext that exists is
+// left untouched.
+func (bx *Box) Reencrypt(names []string, bulkpause bool) error {
 
 	allFiles := false
 
 	if err := anyGpg(names); err != nil {
 		return err
 	}
+	if err := bx.notInFilterMode("reencrypt"); err != nil {
+		return err
+	}
 	if err := bx.getAdmins(); err != nil {
 		return err
 	}
 	if err := bx.getFiles(); err != nil {
 		return err
 	}
-	if len(names) == 0 {
-		names = bx.Files
+	keys, err := bx.keys(names)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		keys = bx.Files
 		allFiles = true
 	}
 
@@ -476,55 +1730,112 @@ func (bx *Box) Reencrypt(names []string, overwrite bool, bulkpause bool) error {
 	}
 
 	fmt.Println("========== blackbox administrators are:")
-	bx.AdminList()
+	for _, v := range bx.Admins {
+		fmt.Println(v)
+	}
 	fmt.Println("========== (the above people will be able to access the file)")
 
-	if overwrite {
-		bbutil.ShredFiles(names)
-	} else {
-		warned := false
-		for _, n := range names {
-			if bbutil.FileExistsOrProblem(n) {
-				if !warned {
-					fmt.Printf("========== Shred these files?\n")
-					warned = true
-				}
-				fmt.Println("SHRED?", n)
-			}
+	var todo []string
+	for _, key := range keys {
+		if !bx.FilesSet[key] {
+			bx.logErr.Printf("Skipping %q: File not registered with Blackbox", bx.path(key))
+			continue
 		}
-		if warned {
-			shouldWeOverwrite()
+		todo = append(todo, key)
+	}
+
+	results := make([]string, len(todo))
+	errs := bbutil.Parallel(bx.Parallel, len(todo), os.Stdout, func(i int, out io.Writer) error {
+		fmt.Fprintf(out, "========== REENCRYPTING %q\n", bx.path(todo[i]))
+		var err error
+		results[i], err = bx.reencryptOne(todo[i])
+		return err
+	})
+
+	var done, enames, failed []string
+	for i, err := range errs {
+		if err != nil {
+			bx.logErr.Printf("%q: %v", bx.path(todo[i]), err)
+			failed = append(failed, bx.path(todo[i]))
+			continue
 		}
+		done = append(done, todo[i])
+		enames = append(enames, results[i])
 	}
 
-	// Decrypt
-	if err := decryptMany(bx, names, overwrite, false, 0); err != nil {
-		return fmt.Errorf("reencrypt failed decrypt: %w", err)
+	if len(enames) != 0 {
+		msg := "REENCRYPT all files"
+		if !allFiles || len(failed) != 0 {
+			msg = PrettyCommitMessage("REENCRYPT", done)
+		}
+		bx.Vcs.NeedsCommit(msg, bx.RepoBaseDir, enames)
 	}
-	enames, err := encryptMany(bx, names, false)
+
+	return failures("reencrypt", failed)
+}
+
+// reencryptOne re-encrypts the .gpg file of the registered file key, in
+// memory. It returns the .gpg file's name.
+func (bx *Box) reencryptOne(key string) (string, error) {
+	ename := bx.path(key) + ".gpg"
+	encrypted, err := ioutil.ReadFile(ename)
 	if err != nil {
-		return fmt.Errorf("reencrypt failed encrypt: %w", err)
+		return "", err
 	}
-	if err := bbutil.ShredFiles(names); err != nil {
-		return fmt.Errorf("reencrypt failed shred: %w", err)
+	plain, err := bx.Crypter.DecryptBytes(encrypted)
+	if err != nil {
+		return "", fmt.Errorf("can not decrypt: %w", err)
 	}
+	return bx.writeEncrypted(key, plain)
+}
 
-	if allFiles {
-		// If the "--all" flag was used, don't try to list all the files.
-		bx.Vcs.NeedsCommit(
-			"REENCRYPT all files",
-			bx.RepoBaseDir,
-			enames,
-		)
-	} else {
-		bx.Vcs.NeedsCommit(
-			PrettyCommitMessage("REENCRYPT", names),
-			bx.RepoBaseDir,
-			enames,
-		)
+// Set changes the value at path (i.e. "db.password") in the registered
+// YAML, JSON or dotenv file name, and re-encrypts it. The rest of the
+// file is unchanged. The file is decrypted in memory; the plaintext is
+// never written to disk.
+func (bx *Box) Set(name, path, value string) error {
+	if err := bx.notInFilterMode("set"); err != nil {
+		return err
+	}
+	f, err := structured.FormatOf(name)
+	if err != nil {
+		return err
+	}
+	data, err := bx.secret(name)
+	if err != nil {
+		return err
+	}
+	changed, err := structured.Set(f, data, path, value)
+	if err != nil {
+		return fmt.Errorf("%q: %w", name, err)
+	}
+	if bytes.Equal(changed, data) {
+		fmt.Printf("========== UNCHANGED %q\n", name)
+		return nil
+	}
 
+	key, err := bx.key(name)
+	if err != nil {
+		return err
+	}
+	if err := bx.validate(key, changed); err != nil {
+		return err
+	}
+	fmt.Printf("========== ENCRYPTING %q\n", bx.path(key))
+	ename, err := bx.writeEncrypted(key, changed)
+	if err != nil {
+		return err
+	}
+	if bbutil.FileExistsOrProblem(bx.path(key)) {
+		bx.logErr.Printf("WARNING: %q is now out of date. Run: blackbox decrypt --overwrite %s",
+			bx.path(key), makesafe.Shell(bx.path(key)))
 	}
 
+	bx.Vcs.NeedsCommit(
+		PrettyCommitMessage("ENCRYPTED", []string{key}),
+		bx.RepoBaseDir,
+		[]string{ename},
+	)
 	return nil
 }
 
@@ -534,6 +1845,9 @@ func (bx *Box) Shred(names []string) error {
 	if err := anyGpg(names); err != nil {
 		return err
 	}
+	if err := bx.notInFilterMode("shred"); err != nil {
+		return err
+	}
 
 	err := bx.getFiles()
 	// Calling getFiles() has the benefit of making sure we are in a repo.
@@ -541,71 +1855,115 @@ func (bx *Box) Shred(names []string) error {
 		return err
 	}
 
-	if len(names) == 0 {
-		names = bx.Files
+	// Unregistered files may be shredded, but only if they are in the repo.
+	keys, err := bx.keys(names)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		keys = bx.Files
 	}
 
-	return bbutil.ShredFiles(names)
+	return bbutil.ShredFiles(bx.paths(keys), bx.Parallel, bx.DryRun)
+}
+
+// FileState is the status of a file, as reported by Status.
+type FileState struct {
+	Status string `json:"status"` // See FileStatus and deepFileStatus.
+	Name   string `json:"name"`   // Relative to the current directory.
+	Error  string `json:"error,omitempty"`
+	Repo   string `json:"repo,omitempty"` // The repo's base directory (only with --recursive).
 }
 
-// Status prints the status of files.
-func (bx *Box) Status(names []string, nameOnly bool, match string) error {
+// Status reports the status of files (all registered files if names is
+// empty). If match is not "", only files with that status are reported.
+// If deep is set, the files are decrypted (in memory) and compared with
+// the plaintext, rather than judged by their timestamps.
+func (bx *Box) Status(names []string, match string, deep bool) ([]FileState, error) {
 
 	err := bx.getFiles()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	var flist []string
 	if len(names) == 0 {
 		flist = bx.Files
 	} else {
-		flist = names
+		flist, err = bx.keys(names)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	var data [][]string
-	var onlylist []string
-	thirdColumn := false
-	var tcData bool
-
-	for _, name := range flist {
+	all := make([]FileState, len(flist))
+	bbutil.Parallel(bx.Parallel, len(flist), ioutil.Discard, func(i int, out io.Writer) error {
+		name := bx.path(flist[i])
 		var stat string
 		var err error
-		if _, ok := bx.FilesSet[name]; ok {
-			stat, err = FileStatus(name)
-		} else {
+		switch {
+		case !bx.FilesSet[flist[i]]:
 			stat, err = "NOTREG", nil
+		case deep:
+			stat, err = bx.deepFileStatus(name)
+		default:
+			stat, err = FileStatus(name)
 		}
-		if (match == "") || (stat == match) {
-			if err == nil {
-				data = append(data, []string{stat, name})
-				onlylist = append(onlylist, name)
-			} else {
-				thirdColumn = tcData
-				data = append(data, []string{stat, name, fmt.Sprintf("%v", err)})
-				onlylist = append(onlylist, fmt.Sprintf("%v: %v", name, err))
-			}
+		all[i] = FileState{Status: stat, Name: name}
+		if err != nil {
+			all[i].Error = err.Error()
 		}
-	}
-
-	if nameOnly {
-		fmt.Println(strings.Join(onlylist, "\n"))
 		return nil
+	})
+
+	states := []FileState{}
+	for _, s := range all {
+		if (match == "") || (s.Status == match) {
+			states = append(states, s)
+		}
 	}
+	return states, nil
+}
 
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetAutoWrapText(false)
-	if thirdColumn {
-		table.SetHeader([]string{"Status", "Name", "Error"})
-	} else {
-		table.SetHeader([]string{"Status", "Name"})
+// Textconv outputs the decrypted contents of filename, which is an
+// encrypted file (but not necessarily named *.gpg). The VCS calls this to
+// display diffs of encrypted files. It never fails, since that would
+// abort the diff for everyone who can't decrypt (i.e. CI, non-admins):
+// a file that can't be decrypted is output as a one-line placeholder.
+func (bx *Box) Textconv(filename string) error {
+	bx.textconv(os.Stdout, filename)
+	return nil
+}
+
+// textconv writes what Textconv outputs to w.
+func (bx *Box) textconv(w io.Writer, filename string) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		bx.logErr.Printf("textconv: %v", err)
+		fmt.Fprintf(w, "[blackbox: can not read the file]\n")
+		return
 	}
-	for _, v := range data {
-		table.Append(v)
+	if bx.Crypter.IsEncrypted(data) {
+		plain, err := bx.Crypter.DecryptBytes(data)
+		if err != nil {
+			// The hash makes the placeholders differ if the files do.
+			bx.logErr.Printf("textconv: can not decrypt: %v", err)
+			fmt.Fprintf(w, "[blackbox: encrypted, can not decrypt: sha256 %x]\n", sha256.Sum256(data))
+			return
+		}
+		data = plain
 	}
-	table.Render() // Send output
+	w.Write(data)
+}
 
-	return nil
+// TextconvInstall configures the VCS to show the diffs of registered
+// files decrypted (for users that can decrypt them).
+func (bx *Box) TextconvInstall() error {
+	err := bx.Vcs.SetDiffDriver(bx.RepoBaseDir, diffDriver, diffCommand)
+	if err != nil {
+		return err
+	}
+	return bx.syncVcs()
 }
 
 // TestingInitRepo initializes a repo.
@@ -631,3 +1989,72 @@ func (bx *Box) TestingInitRepo() error {
 	}
 	return nil
 }
+
+// Validate checks the registered files with the validators in the
+// config. The files are decrypted in memory. Files that no validator
+// applies to are skipped.
+func (bx *Box) Validate(names []string) error {
+	if err := anyGpg(names); err != nil {
+		return err
+	}
+	if err := bx.getFiles(); err != nil {
+		return err
+	}
+	keys, err := bx.keys(names)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		keys = bx.Files
+	}
+
+	var checked, skipped int
+	var invalid []string
+	for _, key := range keys {
+		name := bx.path(key)
+		if !bx.FilesSet[key] {
+			bx.logErr.Printf("Skipping %q: File not registered with Blackbox", name)
+			continue
+		}
+		vs, err := bx.validators(key)
+		if err != nil {
+			return err
+		}
+		if len(vs) == 0 {
+			skipped++
+			continue
+		}
+		checked++
+		data, err := bx.Crypter.Cat(name)
+		if err == nil {
+			data, err = bx.plaintext(data)
+		}
+		if err == nil {
+			err = bx.validate(key, data)
+		}
+		if err != nil {
+			fmt.Printf("========== INVALID %q: %v\n", name, err)
+			invalid = append(invalid, name)
+			continue
+		}
+		fmt.Printf("========== VALID %q\n", name)
+	}
+
+	fmt.Printf("========== VALIDATED: %d files, %d invalid, %d without validators\n",
+		checked, len(invalid), skipped)
+	if len(invalid) != 0 {
+		return fmt.Errorf("%d file(s) are not valid: %s", len(invalid), makesafe.FirstFew(makesafe.ShellMany(invalid)))
+	}
+	return nil
+}
+
+// VcsSync regenerates the ignores and attributes that blackbox maintains
+// in the VCS, repairing any drift from the registry. It also configures
+// this checkout's diff, merge and filter drivers.
+func (bx *Box) VcsSync() error {
+	err := bx.setDrivers()
+	if err != nil {
+		return err
+	}
+	return bx.syncVcs()
+}
@@ -0,0 +1,149 @@
+package box
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/StackExchange/blackbox/v2/pkg/bblog"
+)
+
+func TestTextconv(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "bbtextconv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	for i, test := range []struct {
+		data     string // "" means the file is missing.
+		noKey    bool
+		expected string // A prefix of the output.
+	}{
+		{"ENC:secret\n", false, "secret\n"},
+		{"plain\n", false, "plain\n"},
+		{"ENC", false, "ENC"},
+		{"ENC:secret\n", true, "[blackbox: encrypted, can not decrypt: sha256 "},
+		{"", false, "[blackbox: can not read the file]\n"},
+	} {
+		bx := &Box{Crypter: fakeCrypter{noKey: test.noKey}, logErr: bblog.GetDebug(false)}
+		fn := filepath.Join(tmp, "file.gpg")
+		os.Remove(fn)
+		if test.data != "" {
+			if err := ioutil.WriteFile(fn, []byte(test.data), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var out bytes.Buffer
+		bx.textconv(&out, fn)
+		if g := out.String(); !strings.HasPrefix(g, test.expected) {
+			t.Errorf("%03d: FAILED %q: got=%q wanted=%q", i, test.data, g, test.expected)
+		}
+	}
+}
+
+func TestMergeEncryptedConflict(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "bbmerge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	write := func(name, data string) string {
+		fn := filepath.Join(tmp, name)
+		if err := ioutil.WriteFile(fn, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return fn
+	}
+	base := write("base", "ENC:a\n")
+	ours := write("ours", "ENC:b\n")
+	theirs := write("theirs", "ENC:c\n")
+	pname := filepath.Join(tmp, "secret.txt")
+
+	bx := &Box{
+		RepoBaseDir: tmp,
+		ConfigPath:  filepath.Join(tmp, ".blackbox"),
+		Crypter:     fakeCrypter{},
+		logErr:      bblog.GetErr(),
+		logDebug:    bblog.GetDebug(false),
+	}
+	for i, test := range []struct {
+		plain   string // The plaintext before the merge. "" means it is missing.
+		written bool   // Whether the merge is written to it.
+	}{
+		{"", true},
+		{"b\n", true},               // Decrypted, unchanged.
+		{"b\nmy edits\n", false},    // Not encrypted yet.
+		{"something else\n", false}, // Not encrypted yet.
+	} {
+		os.Remove(pname)
+		if test.plain != "" {
+			write("secret.txt", test.plain)
+		}
+		if err := mergeEncrypted(bx, base, ours, theirs, "secret.txt.gpg"); err == nil {
+			t.Errorf("%03d: FAILED %q: no error for the conflict", i, test.plain)
+		}
+		g, _ := ioutil.ReadFile(pname)
+		if written := strings.Contains(string(g), "<<<<<<<"); written != test.written {
+			t.Errorf("%03d: FAILED %q: written=%v, plaintext=%q", i, test.plain, written, g)
+		}
+		if !test.written && string(g) != test.plain {
+			t.Errorf("%03d: FAILED %q: plaintext was changed to %q", i, test.plain, g)
+		}
+		if o, _ := ioutil.ReadFile(ours); string(o) != "ENC:b\n" {
+			t.Errorf("%03d: FAILED %q: ours was changed to %q", i, test.plain, o)
+		}
+	}
+}
+
+func TestAuditHistory(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "bbaudit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	config := filepath.Join(tmp, ".blackbox")
+	if err := os.Mkdir(config, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{
+		".blackbox/blackbox-files.txt": "a.txt\n",
+		"a.txt.gpg":                    "ENC:secret",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(tmp, name), []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, test := range []struct {
+		mode    string
+		history map[string]string
+		leaked  bool
+	}{
+		{ModeFiles, map[string]string{"a.txt.gpg": "ENC:secret"}, false},
+		{ModeFiles, map[string]string{"a.txt": "old secret"}, true},
+		{ModeFiles, map[string]string{"copy.txt": "secret"}, true},
+		// In filter mode the VCS stores a.txt itself, encrypted.
+		{ModeFilter, map[string]string{"a.txt": "ENC:secret"}, false},
+		{ModeFilter, map[string]string{"a.txt": "old secret"}, true},
+		{ModeFilter, map[string]string{"copy.txt": "secret"}, true},
+	} {
+		bx := &Box{
+			RepoBaseDir: tmp,
+			ConfigPath:  config,
+			Config:      &Config{Mode: test.mode},
+			Vcs:         fakeVcs{history: test.history},
+			Crypter:     fakeCrypter{},
+			logErr:      bblog.GetDebug(false),
+			logDebug:    bblog.GetDebug(false),
+		}
+		if err := bx.AuditHistory(); (err != nil) != test.leaked {
+			t.Errorf("%03d: FAILED %s %v: err=%v", i, test.mode, test.history, err)
+		}
+	}
+}
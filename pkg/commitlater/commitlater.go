@@ -8,6 +8,7 @@ type future struct {
 	message string   // Message that describes this transaction.
 	dir     string   // Basedir of the files
 	files   []string // Names of the files
+	untrack []string // Names of the files to remove from the VCS, but not from disk
 	display []string // Names as to be displayed to the user
 }
 
@@ -26,6 +27,17 @@ func (list *List) Add(message string, repobasedir string, files []string) {
 	list.items = append(list.items, item)
 }
 
+// Untrack queues up a future commit that removes files from the VCS, but
+// not from disk.
+func (list *List) Untrack(message string, repobasedir string, files []string) {
+	item := &future{
+		message: message,
+		dir:     repobasedir,
+		untrack: files,
+	}
+	list.items = append(list.items, item)
+}
+
 func sameDirs(l *List) bool {
 	if len(l.items) <= 1 {
 		return true
@@ -38,21 +50,28 @@ func sameDirs(l *List) bool {
 	return true
 }
 
-// Flush executes queued commits.
+// Flush executes queued commits. fadd is given the basedir and the
+// names of the files to add, funtrack the names of the files to untrack.
+// fcommit is given both.
 func (list *List) Flush(
 	title string,
-	fadd func([]string) error,
-	fcommit func([]string, string, []string) error,
+	fadd func(string, []string) error,
+	funtrack func(string, []string) error,
+	fcommit func([]string, string, []string, []string) error,
 ) error {
 
 	// Just list the individual commit commands.
 	if title == "" || len(list.items) < 2 || !sameDirs(list) {
 		for _, fut := range list.items {
-			err := fadd(fut.files)
+			err := fadd(fut.dir, fut.files)
 			if err != nil {
 				return fmt.Errorf("add files1 (%q) failed: %w", fut.files, err)
 			}
-			err = fcommit([]string{fut.message}, fut.dir, fut.files)
+			err = funtrack(fut.dir, fut.untrack)
+			if err != nil {
+				return fmt.Errorf("untrack files1 (%q) failed: %w", fut.untrack, err)
+			}
+			err = fcommit([]string{fut.message}, fut.dir, fut.files, fut.untrack)
 			if err != nil {
 				return fmt.Errorf("commit files (%q) failed: %w", fut.files, err)
 			}
@@ -62,20 +81,25 @@ func (list *List) Flush(
 
 	// Create a long commit message.
 	var m []string
-	var f []string
+	var f, u []string
 	for _, fut := range list.items {
-		err := fadd(fut.files)
+		err := fadd(fut.dir, fut.files)
 		if err != nil {
 			return fmt.Errorf("add files2 (%q) failed: %w", fut.files, err)
 		}
+		err = funtrack(fut.dir, fut.untrack)
+		if err != nil {
+			return fmt.Errorf("untrack files2 (%q) failed: %w", fut.untrack, err)
+		}
 		m = append(m, fut.message)
 		f = append(f, fut.files...)
+		u = append(u, fut.untrack...)
 	}
 	msg := []string{title}
 	for _, mm := range m {
 		msg = append(msg, "    * "+mm)
 	}
-	err := fcommit(msg, list.items[0].dir, f)
+	err := fcommit(msg, list.items[0].dir, f, u)
 	if err != nil {
 		return fmt.Errorf("commit files (%q) failed: %w", f, err)
 	}
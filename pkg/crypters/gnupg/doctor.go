@@ -0,0 +1,210 @@
+package gnupg
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/StackExchange/blackbox/v2/models"
+	"github.com/StackExchange/blackbox/v2/pkg/bbutil"
+)
+
+// minVersion is the oldest GnuPG that works. Earlier versions' file
+// formats and agents are incompatible (and they don't start the agent
+// when it is needed).
+const minVersion = "2.1.0"
+
+// Doctor checks that GnuPG is installed and working, that one of admins
+// has a secret key here, and that the repo's keyring is readable. If
+// keyringdir is "" (there is no repo), only GnuPG itself is checked.
+func (crypt CrypterHandle) Doctor(keyringdir string, admins []string) []models.Check {
+	checks := []models.Check{
+		crypt.checkVersion(),
+		checkAgent(),
+	}
+	if keyringdir == "" {
+		return checks
+	}
+	return append(checks,
+		crypt.checkSecretKey(admins),
+		crypt.checkKeyring(keyringdir, admins),
+	)
+}
+
+func (crypt CrypterHandle) checkVersion() models.Check {
+	c := models.Check{Name: "gpg"}
+	out, err := bbutil.RunBashOutputSilent(crypt.GPGCmd, "--version")
+	if err != nil {
+		c.Detail = fmt.Sprintf("%s can not be run: %v", crypt.GPGCmd, err)
+		c.Hint = "Install GnuPG " + minVersion + " or later (i.e. apt install gnupg, brew install gnupg)."
+		return c
+	}
+	v, ok := bbutil.VersionAtLeast(out, minVersion)
+	c.Detail = fmt.Sprintf("%s version %s", crypt.GPGCmd, v)
+	if !ok {
+		c.Detail += ", but " + minVersion + " or later is required"
+		c.Hint = "Upgrade GnuPG (or put gpg2 in your PATH)."
+		return c
+	}
+	c.OK = true
+	return c
+}
+
+func checkAgent() models.Check {
+	c := models.Check{Name: "gpg-agent"}
+	out, err := bbutil.RunBashOutputSilent("gpg-agent", "--version")
+	if err != nil {
+		c.Detail = fmt.Sprintf("gpg-agent can not be run: %v", err)
+		c.Hint = "Install GnuPG " + minVersion + " or later, which includes gpg-agent."
+		return c
+	}
+	v, ok := bbutil.VersionAtLeast(out, minVersion)
+	if !ok {
+		c.Detail = fmt.Sprintf("gpg-agent version %s, but %s or later is required", v, minVersion)
+		c.Hint = "Upgrade GnuPG, and stop the old agent (gpgconf --kill gpg-agent)."
+		return c
+	}
+	// This starts the agent if it isn't running, as gpg would.
+	if _, err := bbutil.RunBashOutputSilent("gpg-connect-agent", "/bye"); err != nil {
+		c.Detail = fmt.Sprintf("gpg-agent version %s can not be reached: %v", v, err)
+		c.Hint = "Start it: gpgconf --launch gpg-agent. (Check the permissions of ~/.gnupg.)"
+		return c
+	}
+	c.Detail = fmt.Sprintf("gpg-agent version %s is running", v)
+	c.OK = true
+	return c
+}
+
+func (crypt CrypterHandle) checkSecretKey(admins []string) models.Check {
+	c := models.Check{Name: "secret key"}
+	if len(admins) == 0 {
+		c.Detail = "there are no admins"
+		c.Hint = "Add yourself: blackbox admin add YOUR-KEY-ID"
+		return c
+	}
+	out, err := bbutil.RunBashOutputSilent(crypt.GPGCmd, "--list-secret-keys", "--with-colons")
+	if err != nil {
+		c.Detail = fmt.Sprintf("can not list your secret keys: %v", err)
+		c.Hint = "Check that gpg --list-secret-keys works."
+		return c
+	}
+	ids := keyIDs(out)
+	for _, a := range admins {
+		if matchKey(ids, a) {
+			c.Detail = "you have the secret key of " + a
+			c.OK = true
+			return c
+		}
+	}
+	c.Detail = "you have the secret key of none of the admins, so you can not decrypt"
+	c.Hint = "Ask an admin to run: blackbox admin add YOUR-KEY-ID && blackbox reencrypt --all"
+	return c
+}
+
+func (crypt CrypterHandle) checkKeyring(keyringdir string, admins []string) models.Check {
+	c := models.Check{Name: "repo keyring"}
+	keyring := findKeyring(keyringdir)
+	if keyring == "" {
+		c.Detail = fmt.Sprintf("no pubring.kbx or pubring.gpg in %q", keyringdir)
+		c.Hint = "Adding an admin creates it: blackbox admin add KEY-ID"
+		return c
+	}
+	f, err := os.Open(keyring)
+	if err != nil {
+		c.Detail = err.Error()
+		c.Hint = "Fix the permissions of " + keyring
+		return c
+	}
+	f.Close()
+
+	out, err := crypt.listKeyring(keyring)
+	if err != nil {
+		c.Detail = err.Error()
+		c.Hint = "It may have been written by another version of GnuPG. All admins should use GnuPG " + minVersion + " or later."
+		return c
+	}
+	ids := keyIDs(out)
+	var missing []string
+	for _, a := range admins {
+		if !matchKey(ids, a) {
+			missing = append(missing, a)
+		}
+	}
+	if len(missing) != 0 {
+		c.Detail = fmt.Sprintf("%q has no public key for: %s", keyring, strings.Join(missing, " "))
+		c.Hint = "Add each again: blackbox admin add KEY-ID"
+		return c
+	}
+	c.Detail = fmt.Sprintf("%q has the public keys of all %d admins", keyring, len(admins))
+	c.OK = true
+	return c
+}
+
+// keyInfo is the user-ids and fingerprints of keys (and their subkeys).
+type keyInfo struct {
+	uids []string
+	fprs []string
+}
+
+// keyIDs returns the user-ids and fingerprints in the output of
+// gpg --with-colons.
+func keyIDs(out string) keyInfo {
+	var k keyInfo
+	for _, l := range strings.Split(out, "\n") {
+		f := strings.Split(l, ":")
+		if len(f) <= 9 {
+			continue
+		}
+		switch f[0] {
+		case "uid":
+			k.uids = append(k.uids, f[9])
+		case "fpr":
+			k.fprs = append(k.fprs, f[9])
+		}
+	}
+	return k
+}
+
+// matchKey reports whether admin (as given to gpg -r) is one of the keys
+// in k. A key id or fingerprint matches the end of a fingerprint. Anything
+// else must be a whole user-id, or the email address in one (the part in
+// <>), ignoring case. Unlike gpg, substrings don't match: "bob@example.com"
+// is not "jimbob@example.com".
+func matchKey(k keyInfo, admin string) bool {
+	if id := strings.TrimPrefix(strings.TrimPrefix(admin, "0x"), "0X"); isKeyID(id) {
+		for _, fpr := range k.fprs {
+			if strings.HasSuffix(strings.ToUpper(fpr), strings.ToUpper(id)) {
+				return true
+			}
+		}
+	}
+	email := strings.TrimSuffix(strings.TrimPrefix(admin, "<"), ">")
+	for _, uid := range k.uids {
+		if strings.EqualFold(uid, admin) {
+			return true
+		}
+		if i, j := strings.LastIndex(uid, "<"), strings.LastIndex(uid, ">"); i != -1 && j > i {
+			uid = uid[i+1 : j]
+		}
+		if strings.EqualFold(uid, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// isKeyID reports whether s is a (short or long) key id or a fingerprint:
+// 8, 16, 40 or 64 hex digits.
+func isKeyID(s string) bool {
+	switch len(s) {
+	case 8, 16, 40, 64:
+	default:
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
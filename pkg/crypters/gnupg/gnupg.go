@@ -1,6 +1,7 @@
 package gnupg
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -22,13 +23,15 @@ func init() {
 // CrypterHandle is the handle
 type CrypterHandle struct {
 	GPGCmd   string // "gpg2" or "gpg"
+	dryRun   bool   // Don't write files, only say what would be written.
 	logErr   *log.Logger
 	logDebug *log.Logger
 }
 
-func registerNew(debug bool) (crypters.Crypter, error) {
+func registerNew(debug, dryRun bool) (crypters.Crypter, error) {
 
 	crypt := &CrypterHandle{
+		dryRun:   dryRun,
 		logErr:   bblog.GetErr(),
 		logDebug: bblog.GetDebug(debug),
 	}
@@ -51,35 +54,33 @@ func (crypt CrypterHandle) Name() string {
 	return pluginName
 }
 
-// Decrypt name+".gpg", possibly overwriting name.
+// Decrypt name+".gpg", possibly overwriting name. A new name gets the
+// permissions 0666 minus umask. (The process's umask is not changed, so
+// this may be called concurrently.)
 func (crypt CrypterHandle) Decrypt(filename string, umask int, overwrite bool) error {
-
+	if !overwrite && bbutil.FileExistsOrProblem(filename) {
+		return fmt.Errorf("%q exists (and overwrite is not set)", filename)
+	}
+	if crypt.dryRun {
+		bbutil.DryRunf("would decrypt %q", filename)
+		return nil
+	}
 	a := []string{
 		"--use-agent",
 		"-q",
 		"--decrypt",
-		"-o", filename,
+		filename + ".gpg",
 	}
-	if overwrite {
-		a = append(a, "--yes")
+	plaintext, err := bbutil.RunBashOutput(crypt.GPGCmd, a...)
+	if err != nil {
+		return err
 	}
-	a = append(a, filename+".gpg")
-
-	oldumask := bbutil.Umask(umask)
-	err := bbutil.RunBash(crypt.GPGCmd, a...)
-	bbutil.Umask(oldumask)
-	return err
+	return bbutil.WriteFileMode(filename, []byte(plaintext), 0o666&^os.FileMode(umask), !overwrite)
 }
 
 // Cat returns the plaintext or, if it is missing, the decrypted cyphertext.
 func (crypt CrypterHandle) Cat(filename string) ([]byte, error) {
 
-	a := []string{
-		"--use-agent",
-		"-q",
-		"--decrypt",
-	}
-
 	// TODO(tlim): This assumes the entire gpg file fits in memory. If
 	// this becomes a problem, re-implement this using exec Cmd.StdinPipe()
 	// and feed the input in chunks.
@@ -94,34 +95,79 @@ func (crypt CrypterHandle) Cat(filename string) ([]byte, error) {
 		return nil, err
 	}
 
-	return bbutil.RunBashInputOutput(in, crypt.GPGCmd, a...)
+	return crypt.DecryptBytes(in)
 }
 
-// Encrypt name, overwriting name+".gpg"
-func (crypt CrypterHandle) Encrypt(filename string, umask int, receivers []string) (string, error) {
-	var err error
+// DecryptBytes decrypts data that was produced by Encrypt.
+func (crypt CrypterHandle) DecryptBytes(data []byte) ([]byte, error) {
+	a := []string{
+		"--use-agent",
+		"-q",
+		"--decrypt",
+	}
+	return bbutil.RunBashInputOutput(data, crypt.GPGCmd, a...)
+}
+
+// IsEncrypted returns true if data is an OpenPGP encrypted message.
+// Only the first packet is examined. No key is required.
+func (crypt CrypterHandle) IsEncrypted(data []byte) bool {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN PGP MESSAGE-----")) {
+		return true
+	}
+	if len(data) == 0 || data[0]&0x80 == 0 {
+		return false // Not a packet header.
+	}
+	var tag byte
+	if data[0]&0x40 != 0 {
+		tag = data[0] & 0x3f // New format.
+	} else {
+		tag = (data[0] >> 2) & 0x0f // Old format.
+	}
+	// An encrypted message begins with a Public-Key (1) or
+	// Symmetric-Key (3) Encrypted Session Key packet. (RFC 4880 5.1, 5.3)
+	return tag == 1 || tag == 3
+}
 
+// Encrypt name, overwriting name+".gpg", which gets the permissions
+// 0666 minus umask.
+func (crypt CrypterHandle) Encrypt(filename string, umask int, receivers []string) (string, error) {
 	crypt.logDebug.Printf("Encrypt(%q, %d, %q)", filename, umask, receivers)
 	encrypted := filename + ".gpg"
+	if crypt.dryRun {
+		bbutil.DryRunf("would encrypt %q to %q for %q", filename, encrypted, receivers)
+		return encrypted, nil
+	}
 	a := []string{
 		"--use-agent",
 		"--yes",
 		"--encrypt",
-		"-o", encrypted,
+		"-o", "-",
 	}
 	for _, f := range receivers {
 		a = append(a, "-r", f)
 	}
-	a = append(a, "--encrypt")
 	a = append(a, filename)
-	//err = bbutil.RunBash("ls", "-la")
 
-	oldumask := bbutil.Umask(umask)
 	crypt.logDebug.Printf("Args = %q", a)
-	err = bbutil.RunBash(crypt.GPGCmd, a...)
-	bbutil.Umask(oldumask)
+	out, err := bbutil.RunBashOutput(crypt.GPGCmd, a...)
+	if err != nil {
+		return encrypted, err
+	}
+	return encrypted, bbutil.WriteFileMode(encrypted, []byte(out), 0o666&^os.FileMode(umask), false)
+}
 
-	return encrypted, err
+// EncryptBytes encrypts data for receivers.
+func (crypt CrypterHandle) EncryptBytes(data []byte, receivers []string) ([]byte, error) {
+	crypt.logDebug.Printf("EncryptBytes(%d bytes, %q)", len(data), receivers)
+	a := []string{
+		"--use-agent",
+		"--yes",
+		"--encrypt",
+	}
+	for _, f := range receivers {
+		a = append(a, "-r", f)
+	}
+	return bbutil.RunBashInputOutput(data, crypt.GPGCmd, a...)
 }
 
 // AddNewKey extracts keyname from sourcedir's GnuPG chain to destdir keychain.
@@ -146,6 +192,11 @@ func (crypt CrypterHandle) AddNewKey(keyname, repobasedir, sourcedir, destdir st
 		return nil, fmt.Errorf("Nothing found when %q exported from %q", keyname, sourcedir)
 	}
 
+	if crypt.dryRun {
+		bbutil.DryRunf("would import the key for %q into %q", keyname, destdir)
+		return nil, nil
+	}
+
 	// $GPG --no-permission-warning --homedir="$KEYRINGDIR" --import "$pubkeyfile"
 	args = []string{
 		"--no-permission-warning",
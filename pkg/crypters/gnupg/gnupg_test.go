@@ -0,0 +1,117 @@
+package gnupg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIsEncrypted(t *testing.T) {
+	for i, test := range []struct {
+		data     string
+		expected bool
+	}{
+		{"", false},
+		{"plaintext\n", false},
+		{"\x85\x02\x0c\x03", true},                        // Old format, PKESK.
+		{"\x8c\x0d\x04\x09", true},                        // Old format, SKESK.
+		{"\xc1\xc0\x4c\x03", true},                        // New format, PKESK.
+		{"\x99\x01\x0d\x04", false},                       // Old format, public key.
+		{"\xc6\x33\x04\x5f", false},                       // New format, public key.
+		{"-----BEGIN PGP MESSAGE-----\n\nhQEM\n", true},   // Armored.
+		{"-----BEGIN PGP PUBLIC KEY BLOCK-----\n", false}, // Armored, not a message.
+	} {
+		g := CrypterHandle{}.IsEncrypted([]byte(test.data))
+		if g == test.expected {
+			t.Logf("%03d: PASSED", i)
+		} else {
+			t.Errorf("%03d: FAILED data=%q got=%v wanted=%v", i, test.data, g, test.expected)
+		}
+	}
+}
+
+func TestMatchKey(t *testing.T) {
+	ids := keyIDs(`sec:u:255:22:1C3A5B7D9E0F2468:1600000000:::u:::scESC:::+:::ed25519:::0:
+fpr:::::::::0123456789ABCDEF01231C3A5B7D9E0F2468:
+uid:u::::1600000000::ABCDEF::Alice Example <alice@example.com>::::::::::0:
+uid:u::::1600000000::ABCDEF::carol@example.com::::::::::0:
+ssb:u:255:18:2468ACE013579BDF:1600000000::::::e:::+:::cv25519::
+fpr:::::::::FEDCBA98765432100123462468ACE013579BDF:
+`)
+	for i, test := range []struct {
+		admin    string
+		expected bool
+	}{
+		{"alice@example.com", true},
+		{"Alice@Example.com", true},
+		{"<alice@example.com>", true},
+		{"Alice Example <alice@example.com>", true},
+		{"carol@example.com", true},
+		{"1C3A5B7D9E0F2468", true},
+		{"0x1C3A5B7D9E0F2468", true},
+		{"9e0f2468", true},
+		{"0123456789ABCDEF01231C3A5B7D9E0F2468", false}, // Too short for a fingerprint.
+		{"0000000000000000000001231C3A5B7D9E0F2468", false},
+		{"2468ACE013579BDF", true}, // A subkey.
+		{"bob@example.com", false},
+		{"Alice Example", false},
+		{"alice", false},
+		{"ice@example.com", false},
+		{"example.com", false},
+		{"01231C3A", false},
+		{"1C3A5B7D", false},
+	} {
+		if g := matchKey(ids, test.admin); g != test.expected {
+			t.Errorf("%03d: %q: got=%v wanted=%v", i, test.admin, g, test.expected)
+		}
+	}
+}
+
+func TestRecipients(t *testing.T) {
+	g := recipients(`# off=0 ctb=85 tag=1 hlen=3 plen=396
+:pubkey enc packet: version 3, algo 1, keyid 5188514BF987224A
+	data: [3072 bits]
+# off=399 ctb=85 tag=1 hlen=3 plen=94
+:pubkey enc packet: version 3, algo 18, keyid 2468ACE013579BDF
+	data: [263 bits]
+	data: [392 bits]
+# off=496 ctb=d2 tag=18 hlen=2 plen=73 new-ctb
+:encrypted data packet:
+	length: 73
+`)
+	if want := []string{"5188514BF987224A", "2468ACE013579BDF"}; strings.Join(g, " ") != strings.Join(want, " ") {
+		t.Errorf("got=%q wanted=%q", g, want)
+	}
+}
+
+func TestAdminKeyIDs(t *testing.T) {
+	g := adminKeyIDs(`tru::1:1792423900:0:3:1:5
+pub:-:3072:1:29B77BFFC6A402ED:1792423521:::-:::scESC::::::23::0:
+fpr:::::::::D76D321334C3844884BFC34C29B77BFFC6A402ED:
+uid:-::::1792423521::8584F67CD949FA2AE8DDC42E4B29A1BE2888DA32::alice@example.com::::::::::0:
+sub:-:3072:1:5188514BF987224A:1792423521::::::e::::::23:
+fpr:::::::::11CED7DD36B385031992F82C5188514BF987224A:
+pub:-:255:22:1C3A5B7D9E0F2468:1600000000:::-:::scESC:::::ed25519:::0:
+fpr:::::::::0123456789ABCDEF01231C3A5B7D9E0F2468:
+uid:-::::1600000000::ABCDEF::Bob Example <bob@example.com>::::::::::0:
+sub:-:255:18:2468ACE013579BDF:1600000000::::::e:::::cv25519::
+fpr:::::::::FEDCBA98765432100123462468ACE013579BDF:
+pub:-:255:22:0F1E2D3C4B5A6978:1600000000:::-:::scESC:::::ed25519:::0:
+fpr:::::::::00112233445566778899AABB0F1E2D3C4B5A6978:
+uid:-::::1600000000::ABCDEF::Jim Bob <jimbob@example.com>::::::::::0:
+sub:-:255:18:8796A5B4C3D2E1F0:1600000000::::::e:::::cv25519::
+fpr:::::::::FFEEDDCCBBAA99887766554433228796A5B4C3D2E1F0:
+`, []string{"alice@example.com", "1C3A5B7D9E0F2468", "carol@example.com", "bob@example.com", "bob", "example.com", "5B7D9E0F"})
+	for admin, want := range map[string]string{
+		"alice@example.com": "29B77BFFC6A402ED 5188514BF987224A",
+		"1C3A5B7D9E0F2468":  "1C3A5B7D9E0F2468 2468ACE013579BDF",
+		"carol@example.com": "",
+		"bob@example.com":   "1C3A5B7D9E0F2468 2468ACE013579BDF", // Not jimbob@example.com's keys.
+		"bob":               "",
+		"example.com":       "",
+		"5B7D9E0F":          "", // In the middle of 1C3A5B7D9E0F2468.
+	} {
+		if s := strings.Join(g[admin], " "); s != want {
+			t.Errorf("%q: got=%q wanted=%q", admin, s, want)
+		}
+	}
+}
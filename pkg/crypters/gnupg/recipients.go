@@ -0,0 +1,109 @@
+package gnupg
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/StackExchange/blackbox/v2/pkg/bbutil"
+)
+
+// Recipients lists the IDs of the keys that name+".gpg" is encrypted
+// to. Only the packet headers are read, so no secret key is needed.
+func (crypt CrypterHandle) Recipients(filename string) ([]string, error) {
+	out, err := bbutil.RunBashOutputSilent(crypt.GPGCmd, "--batch", "--list-only",
+		"--list-packets", filename+".gpg")
+	if err != nil {
+		return nil, fmt.Errorf("gpg can not read %q: %w", filename+".gpg", err)
+	}
+	return recipients(out), nil
+}
+
+// recipients returns the key IDs of the public-key encrypted session
+// key packets in the output of gpg --list-packets.
+func recipients(out string) []string {
+	var ids []string
+	for _, l := range strings.Split(out, "\n") {
+		if !strings.HasPrefix(l, ":pubkey enc packet:") {
+			continue
+		}
+		if i := strings.Index(l, " keyid "); i != -1 {
+			ids = append(ids, strings.TrimSpace(l[i+len(" keyid "):]))
+		}
+	}
+	return ids
+}
+
+// KeyIDs returns the IDs of the keys (the primary key and its subkeys)
+// of each of admins in the repo's keyring in keyringdir. Admins whose
+// key isn't in the keyring are left out.
+func (crypt CrypterHandle) KeyIDs(keyringdir string, admins []string) (map[string][]string, error) {
+	keyring := findKeyring(keyringdir)
+	if keyring == "" {
+		return nil, fmt.Errorf("no pubring.kbx or pubring.gpg in %q", keyringdir)
+	}
+	out, err := crypt.listKeyring(keyring)
+	if err != nil {
+		return nil, err
+	}
+	return adminKeyIDs(out, admins), nil
+}
+
+// adminKeyIDs returns the IDs of the keys of each of admins in the output
+// of gpg --list-keys --with-colons.
+func adminKeyIDs(out string, admins []string) map[string][]string {
+	// Each key starts with a "pub" record, followed by its uids and
+	// subkeys.
+	var blocks []string
+	for _, l := range strings.Split(out, "\n") {
+		if strings.HasPrefix(l, "pub:") || len(blocks) == 0 {
+			blocks = append(blocks, "")
+		}
+		blocks[len(blocks)-1] += l + "\n"
+	}
+
+	found := make(map[string][]string)
+	for _, b := range blocks {
+		var kids []string
+		for _, l := range strings.Split(b, "\n") {
+			f := strings.Split(l, ":")
+			if len(f) > 4 && (f[0] == "pub" || f[0] == "sub") {
+				kids = append(kids, f[4])
+			}
+		}
+		ids := keyIDs(b)
+		for _, a := range admins {
+			if matchKey(ids, a) {
+				found[a] = append(found[a], kids...)
+			}
+		}
+	}
+	return found
+}
+
+// findKeyring returns the repo's keyring in keyringdir, or "" if there
+// is none.
+func findKeyring(keyringdir string) string {
+	for _, f := range []string{"pubring.kbx", "pubring.gpg"} {
+		if bbutil.FileExistsOrProblem(filepath.Join(keyringdir, f)) {
+			return filepath.Join(keyringdir, f)
+		}
+	}
+	return ""
+}
+
+// listKeyring returns the output of gpg --list-keys --with-colons for the
+// keys in keyring (only).
+func (crypt CrypterHandle) listKeyring(keyring string) (string, error) {
+	// gpg interprets a relative --keyring as relative to its homedir.
+	abs, err := filepath.Abs(keyring)
+	if err != nil {
+		return "", err
+	}
+	out, err := bbutil.RunBashOutputSilent(crypt.GPGCmd, "--no-default-keyring",
+		"--keyring", abs, "--lock-never", "--list-keys", "--with-colons")
+	if err != nil {
+		return "", fmt.Errorf("gpg can not read %q: %w", keyring, err)
+	}
+	return out, nil
+}
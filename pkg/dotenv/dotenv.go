@@ -0,0 +1,202 @@
+// Package dotenv parses dotenv-style files: lines of NAME=value.
+//
+// Blank lines and lines that start with # are ignored. A line may start
+// with "export ". Values may be unquoted (surrounding whitespace and a
+// " #" comment are removed), 'single quoted' (taken literally) or
+// "double quoted" (\n, \r, \t, \", \\ and \$ are unescaped).
+package dotenv
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Var is a variable set by a dotenv file.
+type Var struct {
+	Name  string
+	Value string
+}
+
+// Parse returns the variables set by data, in the order they are set.
+func Parse(data []byte) ([]Var, error) {
+	var vars []Var
+	for i, line := range strings.Split(string(data), "\n") {
+		a, ok, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		if ok {
+			vars = append(vars, Var{Name: a.name, Value: a.value})
+		}
+	}
+	return vars, nil
+}
+
+// Get returns the value of the variable name. If it is set more than
+// once, the last value is returned, as a shell would.
+func Get(data []byte, name string) (string, bool, error) {
+	vars, err := Parse(data)
+	if err != nil {
+		return "", false, err
+	}
+	for i := len(vars) - 1; i >= 0; i-- {
+		if vars[i].Name == name {
+			return vars[i].Value, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// Set sets the variable name to value, changing only its value (and
+// only where it is last set). The value keeps its style of quoting if
+// possible. If name is not set, a line that sets it is appended.
+func Set(data []byte, name, value string) ([]byte, error) {
+	if !validName(name) {
+		return nil, fmt.Errorf("invalid name %q", name)
+	}
+	lines := strings.Split(string(data), "\n")
+	found := -1
+	var last assignment
+	for i, line := range lines {
+		a, ok, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		if ok && a.name == name {
+			found, last = i, a
+		}
+	}
+
+	if found == -1 {
+		s := string(data)
+		if s != "" && !strings.HasSuffix(s, "\n") {
+			s += "\n"
+		}
+		return []byte(s + name + "=" + quote(value, 0) + "\n"), nil
+	}
+	line := lines[found]
+	lines[found] = line[:last.start] + quote(value, last.quote) + line[last.end:]
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// assignment is a parsed NAME=value line. The text of the value
+// (including any quotes) is line[start:end].
+type assignment struct {
+	name, value string
+	start, end  int
+	quote       byte // 0, '\'' or '"'
+}
+
+// parseLine parses one line. ok is false if the line is blank or a comment.
+func parseLine(line string) (a assignment, ok bool, err error) {
+	line = strings.TrimSuffix(line, "\r")
+	s := strings.TrimLeft(line, " \t")
+	if s == "" || s[0] == '#' {
+		return a, false, nil
+	}
+	if strings.HasPrefix(s, "export ") {
+		s = strings.TrimLeft(strings.TrimPrefix(s, "export "), " \t")
+	}
+	i := strings.IndexByte(s, '=')
+	if i == -1 {
+		return a, false, fmt.Errorf("expected NAME=value")
+	}
+	a.name = strings.TrimSpace(s[:i])
+	if !validName(a.name) {
+		return a, false, fmt.Errorf("invalid name %q", a.name)
+	}
+	v := strings.TrimLeft(s[i+1:], " \t")
+	a.start = len(line) - len(v)
+	var n int
+	a.value, n, err = parseValue(v)
+	if err != nil {
+		return a, false, err
+	}
+	a.end = a.start + n
+	if v != "" && (v[0] == '\'' || v[0] == '"') {
+		a.quote = v[0]
+	}
+	return a, true, nil
+}
+
+func validName(name string) bool {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for _, r := range name {
+		if !(r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseValue parses the text after the = (with leading whitespace
+// removed). It returns the value and the length of its text.
+func parseValue(s string) (string, int, error) {
+	if s == "" {
+		return "", 0, nil
+	}
+	var value string
+	var n int
+	switch s[0] {
+	case '\'':
+		i := strings.IndexByte(s[1:], '\'')
+		if i == -1 {
+			return "", 0, fmt.Errorf("unterminated quote")
+		}
+		value, n = s[1:i+1], i+2
+	case '"':
+		var b strings.Builder
+		i := 1
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 'r':
+					b.WriteByte('\r')
+				case 't':
+					b.WriteByte('\t')
+				case '"', '\\', '$':
+					b.WriteByte(s[i])
+				default:
+					b.WriteByte('\\')
+					b.WriteByte(s[i])
+				}
+				continue
+			}
+			b.WriteByte(s[i])
+		}
+		if i == len(s) {
+			return "", 0, fmt.Errorf("unterminated quote")
+		}
+		value, n = b.String(), i+1
+	default:
+		v := s
+		if i := strings.Index(v, " #"); i != -1 {
+			v = v[:i]
+		}
+		v = strings.TrimRight(v, " \t")
+		return v, len(v), nil
+	}
+	rest := strings.TrimSpace(s[n:])
+	if rest != "" && rest[0] != '#' {
+		return "", 0, fmt.Errorf("unexpected %q after quoted value", rest)
+	}
+	return value, n, nil
+}
+
+// quote returns the text for value. It uses the quote q (0 for none)
+// if that can represent value, otherwise double quotes.
+func quote(value string, q byte) string {
+	switch {
+	case q == 0 && !strings.ContainsAny(value, " \t\r\n#'\"\\$`"):
+		return value
+	case q == '\'' && !strings.ContainsAny(value, "'\r\n"):
+		return "'" + value + "'"
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return `"` + r.Replace(value) + `"`
+}
@@ -0,0 +1,77 @@
+package dotenv
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for i, test := range []struct {
+		data     string
+		expected []Var
+	}{
+		{"", nil},
+		{"# comment\n\n", nil},
+		{"A=1\nB=2\n", []Var{{"A", "1"}, {"B", "2"}}},
+		{"export A=1", []Var{{"A", "1"}}},
+		{"  A = spaced out  \r\n", []Var{{"A", "spaced out"}}},
+		{"A=x # comment", []Var{{"A", "x"}}},
+		{"A=x#not-comment", []Var{{"A", "x#not-comment"}}},
+		{"A=", []Var{{"A", ""}}},
+		{`A='lit\n $B # x'`, []Var{{"A", `lit\n $B # x`}}},
+		{`A="l1\nl2 \"q\" \\ \$ \x" # c`, []Var{{"A", "l1\nl2 \"q\" \\ $ \\x"}}},
+		{`A=b=c`, []Var{{"A", "b=c"}}},
+	} {
+		g, err := Parse([]byte(test.data))
+		if err != nil {
+			t.Errorf("%03d: data=%q error: %v", i, test.data, err)
+			continue
+		}
+		if !reflect.DeepEqual(g, test.expected) {
+			t.Errorf("%03d: data=%q got=%q wanted=%q", i, test.data, g, test.expected)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for i, data := range []string{
+		"JUSTANAME",
+		"1A=x",
+		"A B=x",
+		`A='unterminated`,
+		`A="unterminated`,
+		`A="x" junk`,
+	} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("%03d: data=%q expected an error", i, data)
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	for i, test := range []struct {
+		data, name, value, expected string
+	}{
+		{"A=1\nB=2\n", "A", "x", "A=x\nB=2\n"},
+		{"# c\nexport A = 1 # why\nB=2", "A", "new", "# c\nexport A = new # why\nB=2"},
+		{"A='old' # c\n", "A", "has space", "A='has space' # c\n"},
+		{"A='old'\n", "A", "it's", "A=\"it's\"\n"},
+		{"A=\"old\"\n", "A", "x", "A=\"x\"\n"},
+		{"A=old\n", "A", "a b$c\n", "A=\"a b\\$c\\n\"\n"},
+		{"A=1\nA=2\n", "A", "3", "A=1\nA=3\n"},
+		{"A=1", "B", "2", "A=1\nB=2\n"},
+		{"", "B", "", "B=\n"},
+	} {
+		g, err := Set([]byte(test.data), test.name, test.value)
+		if err != nil {
+			t.Errorf("%03d: error: %v", i, err)
+			continue
+		}
+		if string(g) != test.expected {
+			t.Errorf("%03d: got=%q wanted=%q", i, g, test.expected)
+		}
+		if v, _, err := Get(g, test.name); err != nil || v != test.value {
+			t.Errorf("%03d: Get after Set got=%q (%v) wanted=%q", i, v, err, test.value)
+		}
+	}
+}
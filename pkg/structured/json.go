@@ -0,0 +1,189 @@
+package structured
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jnode is a JSON value, located at data[start:end].
+type jnode struct {
+	kind       byte // '{', '[', '"', or 0 (number, true, false, null)
+	start, end int
+	keys       []string // Objects: the keys of the members.
+	keyStarts  []int    // Objects: where each key starts.
+	keyEnds    []int    // Objects: where each key ends.
+	children   []*jnode // The members' (or items') values.
+}
+
+// jparser parses JSON, recording where each value is.
+type jparser struct {
+	data []byte
+	pos  int
+}
+
+func parseJSON(data []byte) (*jnode, error) {
+	if !json.Valid(data) {
+		var v interface{}
+		return nil, json.Unmarshal(data, &v) // For a helpful error.
+	}
+	p := &jparser{data: data}
+	return p.value()
+}
+
+func (p *jparser) ws() {
+	for p.pos < len(p.data) && strings.IndexByte(" \t\r\n", p.data[p.pos]) != -1 {
+		p.pos++
+	}
+}
+
+// value parses the value at pos. The data is known to be valid JSON.
+func (p *jparser) value() (*jnode, error) {
+	p.ws()
+	n := &jnode{start: p.pos}
+	switch c := p.data[p.pos]; c {
+	case '{', '[':
+		n.kind = c
+		p.pos++
+		for {
+			p.ws()
+			if p.data[p.pos] == '}' || p.data[p.pos] == ']' {
+				p.pos++
+				break
+			}
+			if p.data[p.pos] == ',' {
+				p.pos++
+				p.ws()
+			}
+			if c == '{' {
+				k, err := p.value()
+				if err != nil {
+					return nil, err
+				}
+				var key string
+				if err := json.Unmarshal(p.data[k.start:k.end], &key); err != nil {
+					return nil, err
+				}
+				n.keys = append(n.keys, key)
+				n.keyStarts = append(n.keyStarts, k.start)
+				n.keyEnds = append(n.keyEnds, k.end)
+				p.ws()
+				p.pos++ // The colon.
+			}
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			n.children = append(n.children, v)
+		}
+	case '"':
+		n.kind = c
+		for p.pos++; p.data[p.pos] != '"'; p.pos++ {
+			if p.data[p.pos] == '\\' {
+				p.pos++
+			}
+		}
+		p.pos++
+	default:
+		for p.pos < len(p.data) && strings.IndexByte(",]} \t\r\n", p.data[p.pos]) == -1 {
+			p.pos++
+		}
+	}
+	n.end = p.pos
+	return n, nil
+}
+
+// find returns the node at parts, and its parent (nil for the root).
+// If only the last part is missing from an object, the node is nil.
+func (n *jnode) find(parts []string) (node, parent *jnode, err error) {
+	node = n
+	for i, part := range parts {
+		parent = node
+		node = nil
+		switch parent.kind {
+		case '{':
+			for j, k := range parent.keys {
+				if k == part {
+					node = parent.children[j] // The last one wins.
+				}
+			}
+		case '[':
+			j, err := strconv.Atoi(part)
+			if err != nil || j < 0 || j >= len(parent.children) {
+				return nil, nil, fmt.Errorf("%q: no such item", strings.Join(parts[:i+1], "."))
+			}
+			node = parent.children[j]
+		default:
+			return nil, nil, fmt.Errorf("%q: not an object or array", strings.Join(parts[:i], "."))
+		}
+		if node == nil && i != len(parts)-1 {
+			return nil, nil, fmt.Errorf("%q: not found", strings.Join(parts[:i+1], "."))
+		}
+	}
+	return node, parent, nil
+}
+
+func getJSON(data []byte, parts []string) (string, error) {
+	root, err := parseJSON(data)
+	if err != nil {
+		return "", err
+	}
+	n, _, err := root.find(parts)
+	if err != nil {
+		return "", err
+	}
+	if n == nil {
+		return "", fmt.Errorf("%q: not found", strings.Join(parts, "."))
+	}
+	text := data[n.start:n.end]
+	if n.kind != '"' {
+		return string(text), nil
+	}
+	var s string
+	err = json.Unmarshal(text, &s)
+	return s, err
+}
+
+func setJSON(data []byte, parts []string, value string) ([]byte, error) {
+	root, err := parseJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	n, parent, err := root.find(parts)
+	if err != nil {
+		return nil, err
+	}
+
+	if n != nil {
+		text := jsonString(value)
+		if n.kind != '"' && json.Valid([]byte(value)) {
+			text = value // Not a string before, and still isn't.
+		}
+		return splice(data, n.start, n.end, text), nil
+	}
+
+	// Add a member to parent, in the style of its last member.
+	member := jsonString(parts[len(parts)-1]) + ": " + jsonString(value)
+	if len(parent.children) == 0 {
+		return splice(data, parent.start+1, parent.start+1, member), nil
+	}
+	last := len(parent.children) - 1
+	ks, ke, end := parent.keyStarts[last], parent.keyEnds[last], parent.children[last].end
+	member = jsonString(parts[len(parts)-1]) + string(data[ke:parent.children[last].start]) + jsonString(value)
+	ls := bytes.LastIndexByte(data[:ks], '\n') + 1
+	if indent := data[ls:ks]; ls > parent.start && len(bytes.TrimSpace(indent)) == 0 {
+		return splice(data, end, end, ",\n"+string(indent)+member), nil
+	}
+	return splice(data, end, end, ", "+member), nil
+}
+
+// jsonString returns s as a JSON string.
+func jsonString(s string) string {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,134 @@
+// Package structured gets and sets single values in YAML, JSON and
+// dotenv files, addressed by a key path such as "db.password" or
+// "servers.0.host" (list items are numbered from 0; "\." is a literal
+// dot).
+//
+// Set changes only the text of the one value. The rest of the file
+// (comments, indentation, quoting, order) is left as-is.
+package structured
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/StackExchange/blackbox/v2/pkg/dotenv"
+)
+
+// Format is a file format.
+type Format string
+
+// The supported formats.
+const (
+	YAML   Format = "yaml"
+	JSON   Format = "json"
+	Dotenv Format = "dotenv"
+)
+
+// FormatOf returns the format of filename, based on its name.
+func FormatOf(filename string) (Format, error) {
+	base := strings.ToLower(filepath.Base(filename))
+	switch ext := filepath.Ext(base); {
+	case ext == ".yaml" || ext == ".yml":
+		return YAML, nil
+	case ext == ".json":
+		return JSON, nil
+	case ext == ".env" || base == ".env" || strings.HasPrefix(base, ".env."):
+		return Dotenv, nil
+	}
+	return "", fmt.Errorf("%q: unknown format (expected .yaml, .yml, .json or .env)", filename)
+}
+
+// Split splits a key path into its parts.
+func Split(path string) ([]string, error) {
+	var parts []string
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		switch {
+		case path[i] == '\\' && i+1 < len(path) && path[i+1] == '.':
+			b.WriteByte('.')
+			i++
+		case path[i] == '.':
+			parts = append(parts, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(path[i])
+		}
+	}
+	parts = append(parts, b.String())
+	for _, p := range parts {
+		if p == "" {
+			return nil, fmt.Errorf("invalid key path %q", path)
+		}
+	}
+	return parts, nil
+}
+
+// Get returns the value at path. A value that is not a string, number,
+// etc. (i.e. a map) is returned as text in the file's format.
+func Get(f Format, data []byte, path string) (string, error) {
+	parts, err := Split(path)
+	if err != nil {
+		return "", err
+	}
+	switch f {
+	case YAML:
+		return getYAML(data, parts)
+	case JSON:
+		return getJSON(data, parts)
+	case Dotenv:
+		if len(parts) != 1 {
+			return "", fmt.Errorf("%q: dotenv files have no nested keys", path)
+		}
+		v, ok, err := dotenv.Get(data, parts[0])
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return "", fmt.Errorf("%q: not found", path)
+		}
+		return v, nil
+	}
+	return "", fmt.Errorf("unknown format %q", f)
+}
+
+// Set returns data with the value at path changed to value. If the
+// last part of path doesn't exist, it is added (as a string). Values
+// keep their type (i.e. a number) if the new value is of that type.
+func Set(f Format, data []byte, path, value string) ([]byte, error) {
+	parts, err := Split(path)
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	switch f {
+	case YAML:
+		out, err = setYAML(data, parts, value)
+	case JSON:
+		out, err = setJSON(data, parts, value)
+	case Dotenv:
+		if len(parts) != 1 {
+			return nil, fmt.Errorf("%q: dotenv files have no nested keys", path)
+		}
+		out, err = dotenv.Set(data, parts[0], value)
+	default:
+		return nil, fmt.Errorf("unknown format %q", f)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Never return a corrupted file.
+	if g, err := Get(f, out, path); err != nil || g != value {
+		return nil, fmt.Errorf("%q: can not set this value without changing the rest of the file", path)
+	}
+	return out, nil
+}
+
+// splice returns data with data[start:end] replaced by s.
+func splice(data []byte, start, end int, s string) []byte {
+	out := make([]byte, 0, len(data)-(end-start)+len(s))
+	out = append(out, data[:start]...)
+	out = append(out, s...)
+	return append(out, data[end:]...)
+}
@@ -0,0 +1,175 @@
+package structured
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	for i, test := range []struct {
+		path     string
+		expected []string
+	}{
+		{"a", []string{"a"}},
+		{"a.b.0", []string{"a", "b", "0"}},
+		{`a\.b.c`, []string{"a.b", "c"}},
+		{"a..b", nil},
+		{"", nil},
+	} {
+		g, err := Split(test.path)
+		if test.expected == nil {
+			if err == nil {
+				t.Errorf("%03d: %q expected an error", i, test.path)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(g, test.expected) {
+			t.Errorf("%03d: %q got=%q (%v) wanted=%q", i, test.path, g, err, test.expected)
+		}
+	}
+}
+
+const testYAML = `# Settings.
+db:
+  host: db.example.com   # The primary.
+  port: 5432
+  password: 'old secret'
+  note: "say \"hi\""
+  cert: |
+    line1
+    line2
+  anchored: &a hello
+servers:
+  - name: one
+    ip: 10.0.0.1
+  - name: two
+    ip: 10.0.0.2
+flow: {a: 1}
+last: x
+`
+
+const testJSON = `{
+  "db": {
+    "host": "db.example.com",
+    "port": 5432,
+    "tags": ["a", "b"]
+  },
+  "inline": {"a": 1},
+  "empty": {}
+}
+`
+
+func TestGet(t *testing.T) {
+	for i, test := range []struct {
+		f        Format
+		data     string
+		path     string
+		expected string
+	}{
+		{YAML, testYAML, "db.host", "db.example.com"},
+		{YAML, testYAML, "db.port", "5432"},
+		{YAML, testYAML, "db.password", "old secret"},
+		{YAML, testYAML, "db.note", `say "hi"`},
+		{YAML, testYAML, "db.cert", "line1\nline2\n"},
+		{YAML, testYAML, "servers.1.ip", "10.0.0.2"},
+		{YAML, testYAML, "flow", "{a: 1}\n"},
+		{JSON, testJSON, "db.host", "db.example.com"},
+		{JSON, testJSON, "db.port", "5432"},
+		{JSON, testJSON, "db.tags.1", "b"},
+		{JSON, testJSON, "db.tags", `["a", "b"]`},
+		{Dotenv, "A=1\nB='two'\n", "B", "two"},
+	} {
+		g, err := Get(test.f, []byte(test.data), test.path)
+		if err != nil {
+			t.Errorf("%03d: %s %q: error: %v", i, test.f, test.path, err)
+			continue
+		}
+		if g != test.expected {
+			t.Errorf("%03d: %s %q: got=%q wanted=%q", i, test.f, test.path, g, test.expected)
+		}
+	}
+
+	for i, test := range []struct {
+		f    Format
+		data string
+		path string
+	}{
+		{YAML, testYAML, "db.nope"},
+		{YAML, testYAML, "servers.2"},
+		{YAML, testYAML, "db.port.x"},
+		{JSON, testJSON, "nope"},
+		{JSON, testJSON, "db.tags.x"},
+		{Dotenv, "A=1\n", "B"},
+		{Dotenv, "A=1\n", "A.b"},
+	} {
+		if _, err := Get(test.f, []byte(test.data), test.path); err == nil {
+			t.Errorf("%03d: %s %q: expected an error", i, test.f, test.path)
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	for i, test := range []struct {
+		f           Format
+		data        string
+		path, value string
+		old, new    string // The text that should be replaced.
+	}{
+		{YAML, testYAML, "db.host", "new.example.com",
+			"host: db.example.com   #", "host: new.example.com   #"},
+		{YAML, testYAML, "db.port", "5433", "port: 5432\n", "port: 5433\n"},
+		{YAML, testYAML, "db.port", "none", "port: 5432\n", "port: none\n"},
+		{YAML, testYAML, "db.password", "it's", "'old secret'", "'it''s'"},
+		{YAML, testYAML, "db.note", "x", `"say \"hi\""`, `"x"`},
+		{YAML, testYAML, "db.cert", "new1\nnew2\n",
+			"cert: |\n    line1\n    line2\n", "cert: |\n    new1\n    new2\n"},
+		{YAML, testYAML, "db.anchored", "bye", "&a hello", "&a bye"},
+		{YAML, testYAML, "servers.0.ip", "10.0.0.9", "10.0.0.1", "10.0.0.9"},
+		{YAML, testYAML, "db.host", "two\nlines", "db.example.com", `"two\nlines"`},
+		{YAML, testYAML, "db.user", "123", "  anchored: &a hello\n",
+			"  anchored: &a hello\n  user: \"123\"\n"},
+		{YAML, testYAML, "servers.1.port", "80", "    ip: 10.0.0.2\n",
+			"    ip: 10.0.0.2\n    port: \"80\"\n"},
+		{JSON, testJSON, "db.host", `new "host"`, `"db.example.com"`, `"new \"host\""`},
+		{JSON, testJSON, "db.port", "5433", "5432", "5433"},
+		{JSON, testJSON, "db.port", "none", "5432", `"none"`},
+		{JSON, testJSON, "db.user", "u", `"tags": ["a", "b"]`, `"tags": ["a", "b"],` + "\n" + `    "user": "u"`},
+		{JSON, testJSON, "inline.b", "2", `{"a": 1}`, `{"a": 1, "b": "2"}`},
+		{JSON, testJSON, "empty.a", "<&>", `{}`, `{"a": "<&>"}`},
+		{Dotenv, "A=1\n", "A", "2", "A=1", "A=2"},
+	} {
+		g, err := Set(test.f, []byte(test.data), test.path, test.value)
+		if err != nil {
+			t.Errorf("%03d: %s %q: error: %v", i, test.f, test.path, err)
+			continue
+		}
+		expected := replaceOnce(t, test.data, test.old, test.new)
+		if string(g) != expected {
+			t.Errorf("%03d: %s %q:\ngot:\n%s\nwanted:\n%s", i, test.f, test.path, g, expected)
+		}
+	}
+
+	for i, test := range []struct {
+		f           Format
+		data        string
+		path, value string
+	}{
+		{YAML, testYAML, "db", "x"},
+		{YAML, testYAML, "flow.b", "x"},
+		{YAML, testYAML, "nope.b", "x"},
+		{JSON, "[1]", "a", "x"},
+		{Dotenv, "A=1\n", "A.b", "x"},
+	} {
+		if _, err := Set(test.f, []byte(test.data), test.path, test.value); err == nil {
+			t.Errorf("%03d: %s %q: expected an error", i, test.f, test.path)
+		}
+	}
+}
+
+func replaceOnce(t *testing.T, s, old, new string) string {
+	if !strings.Contains(s, old) {
+		t.Fatalf("test is broken: %q not found", old)
+	}
+	return strings.Replace(s, old, new, 1)
+}
@@ -0,0 +1,300 @@
+package structured
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ydoc is a parsed YAML document, and the text it was parsed from.
+type ydoc struct {
+	data  []byte
+	root  *yaml.Node
+	lines []int // Where each line starts.
+}
+
+func parseYAML(data []byte) (*ydoc, error) {
+	var n yaml.Node
+	if err := yaml.Unmarshal(data, &n); err != nil {
+		return nil, err
+	}
+	if n.Kind != yaml.DocumentNode || len(n.Content) == 0 {
+		return nil, fmt.Errorf("empty YAML document")
+	}
+	d := &ydoc{data: data, root: n.Content[0], lines: []int{0}}
+	for i, c := range data {
+		if c == '\n' {
+			d.lines = append(d.lines, i+1)
+		}
+	}
+	return d, nil
+}
+
+// offset returns where the node starts in data. (Line and Column
+// count from 1, and Column counts characters, not bytes.)
+func (d *ydoc) offset(n *yaml.Node) int {
+	pos := d.lines[n.Line-1]
+	for i := 1; i < n.Column && pos < len(d.data); i++ {
+		_, size := utf8.DecodeRune(d.data[pos:])
+		pos += size
+	}
+	return pos
+}
+
+// lineEnd returns where the line that contains pos ends.
+func (d *ydoc) lineEnd(pos int) int {
+	if i := bytes.IndexByte(d.data[pos:], '\n'); i != -1 {
+		return pos + i
+	}
+	return len(d.data)
+}
+
+// find returns the node at parts, and its parent. If only the last part
+// is missing from a map, the node is nil. Aliases are followed.
+func (d *ydoc) find(parts []string) (node, parent *yaml.Node, err error) {
+	node = d.root
+	for i, part := range parts {
+		for node.Kind == yaml.AliasNode {
+			node = node.Alias
+		}
+		parent = node
+		node = nil
+		switch parent.Kind {
+		case yaml.MappingNode:
+			for j := 0; j+1 < len(parent.Content); j += 2 {
+				if parent.Content[j].Value == part {
+					node = parent.Content[j+1] // The last one wins.
+				}
+			}
+		case yaml.SequenceNode:
+			j, err := strconv.Atoi(part)
+			if err != nil || j < 0 || j >= len(parent.Content) {
+				return nil, nil, fmt.Errorf("%q: no such item", strings.Join(parts[:i+1], "."))
+			}
+			node = parent.Content[j]
+		default:
+			return nil, nil, fmt.Errorf("%q: not a map or list", strings.Join(parts[:i], "."))
+		}
+		if node == nil && i != len(parts)-1 {
+			return nil, nil, fmt.Errorf("%q: not found", strings.Join(parts[:i+1], "."))
+		}
+	}
+	return node, parent, nil
+}
+
+func getYAML(data []byte, parts []string) (string, error) {
+	d, err := parseYAML(data)
+	if err != nil {
+		return "", err
+	}
+	n, _, err := d.find(parts)
+	if err != nil {
+		return "", err
+	}
+	if n == nil {
+		return "", fmt.Errorf("%q: not found", strings.Join(parts, "."))
+	}
+	for n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	if n.Kind == yaml.ScalarNode {
+		return n.Value, nil
+	}
+	b, err := yaml.Marshal(n)
+	return string(b), err
+}
+
+func setYAML(data []byte, parts []string, value string) ([]byte, error) {
+	d, err := parseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	n, parent, err := d.find(parts)
+	if err != nil {
+		return nil, err
+	}
+
+	if n == nil {
+		return d.add(parent, parts[len(parts)-1], value)
+	}
+	if n.Kind != yaml.ScalarNode {
+		return nil, fmt.Errorf("%q: not a single value (or is an alias)", strings.Join(parts, "."))
+	}
+
+	start, end := d.scalar(n)
+	if n.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 && !strings.HasPrefix(value, " ") {
+		return splice(data, start, end, d.block(start, end, value)), nil
+	}
+	tag := n.Tag
+	if t := resolve(value); tag != t {
+		tag = "!!str"
+	}
+	style := n.Style &^ (yaml.TaggedStyle | yaml.LiteralStyle | yaml.FoldedStyle)
+	text, err := yamlScalar(value, tag, style)
+	if err != nil {
+		return nil, err
+	}
+	return splice(data, start, end, text), nil
+}
+
+// scalar returns where the text of the scalar n is, not including any
+// anchor or tag.
+func (d *ydoc) scalar(n *yaml.Node) (start, end int) {
+	data := d.data
+	start = d.offset(n)
+	for start < len(data) && (data[start] == '&' || data[start] == '!') {
+		for start < len(data) && data[start] != ' ' && data[start] != '\n' {
+			start++
+		}
+		for start < len(data) && data[start] == ' ' {
+			start++
+		}
+	}
+
+	switch {
+	case n.Style&yaml.DoubleQuotedStyle != 0:
+		end = start + 1
+		for end < len(data) && data[end] != '"' {
+			if data[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		return start, end + 1
+	case n.Style&yaml.SingleQuotedStyle != 0:
+		end = start + 1
+		for end < len(data) {
+			if data[end] == '\'' {
+				if end+1 < len(data) && data[end+1] == '\'' {
+					end += 2
+					continue
+				}
+				break
+			}
+			end++
+		}
+		return start, end + 1
+	case n.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0:
+		// The block is the lines after the indicator that are blank
+		// or indented at least as much as the first.
+		end = d.lineEnd(start)
+		indent := -1
+		for pos := end + 1; pos < len(data); {
+			le := d.lineEnd(pos)
+			line := data[pos:le]
+			text := bytes.TrimLeft(line, " ")
+			if len(bytes.TrimSpace(text)) != 0 {
+				if indent == -1 {
+					indent = len(line) - len(text)
+				}
+				if len(line)-len(text) < indent || indent == 0 {
+					break
+				}
+				end = le
+			}
+			pos = le + 1
+		}
+		return start, end
+	}
+
+	// A plain scalar ends at the end of the line or a comment.
+	end = d.lineEnd(start)
+	if i := bytes.Index(data[start:end], []byte(" #")); i != -1 {
+		end = start + i
+	}
+	return start, start + len(bytes.TrimRight(data[start:end], " \t\r"))
+}
+
+// block returns value as a literal block scalar that replaces
+// data[start:end], indented like the old one.
+func (d *ydoc) block(start, end int, value string) string {
+	indent := "  "
+	if le := d.lineEnd(start); le < end {
+		line := d.data[le+1 : d.lineEnd(le+1)]
+		indent = string(line[:len(line)-len(bytes.TrimLeft(line, " "))])
+	} else {
+		// An empty block. Indent it more than its line.
+		ls := bytes.LastIndexByte(d.data[:start], '\n') + 1
+		line := d.data[ls:start]
+		indent += string(line[:len(line)-len(bytes.TrimLeft(line, " "))])
+	}
+
+	indicator := "|-"
+	switch {
+	case strings.HasSuffix(value, "\n\n"):
+		indicator = "|+"
+	case strings.HasSuffix(value, "\n"):
+		indicator = "|"
+	}
+	var b strings.Builder
+	b.WriteString(indicator)
+	for _, l := range strings.Split(strings.TrimRight(value, "\n"), "\n") {
+		b.WriteString("\n")
+		if l != "" {
+			b.WriteString(indent + l)
+		}
+	}
+	for i := 1; i < len(value)-len(strings.TrimRight(value, "\n")); i++ {
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// add adds key: value to the block map m, after its last item.
+func (d *ydoc) add(m *yaml.Node, key, value string) ([]byte, error) {
+	if m.Kind != yaml.MappingNode || m.Style&yaml.FlowStyle != 0 || len(m.Content) == 0 {
+		return nil, fmt.Errorf("%q: can only be added to a (non-empty, non-flow) map", key)
+	}
+
+	// Find the end of the last item.
+	last := m.Content[len(m.Content)-1]
+	for (last.Kind == yaml.MappingNode || last.Kind == yaml.SequenceNode) &&
+		last.Style&yaml.FlowStyle == 0 && len(last.Content) != 0 {
+		last = last.Content[len(last.Content)-1]
+	}
+	var end int
+	if last.Kind == yaml.ScalarNode {
+		_, end = d.scalar(last)
+	} else {
+		// A flow collection or alias. Assume it ends on its line.
+		end = d.offset(last)
+	}
+	end = d.lineEnd(end)
+
+	k, err := yamlScalar(key, "!!str", 0)
+	if err != nil {
+		return nil, err
+	}
+	v, err := yamlScalar(value, "!!str", 0)
+	if err != nil {
+		return nil, err
+	}
+	indent := strings.Repeat(" ", m.Content[0].Column-1)
+	return splice(d.data, end, end, "\n"+indent+k+": "+v), nil
+}
+
+// yamlScalar returns value as YAML text that fits on one line.
+func yamlScalar(value, tag string, style yaml.Style) (string, error) {
+	if strings.ContainsAny(value, "\n\r") {
+		style = yaml.DoubleQuotedStyle
+	}
+	b, err := yaml.Marshal(&yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value, Style: style})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(b), "\n"), nil
+}
+
+// resolve returns the tag YAML gives to value as a plain scalar.
+func resolve(value string) string {
+	var n yaml.Node
+	if err := yaml.Unmarshal([]byte(value), &n); err != nil || len(n.Content) == 0 ||
+		n.Content[0].Kind != yaml.ScalarNode || n.Content[0].Value != value {
+		return "!!str"
+	}
+	return n.Content[0].Tag
+}
@@ -0,0 +1,134 @@
+package textdiff
+
+// Three-way merges, as done by "diff3 -m" or "git merge-file".
+
+// hunk is a change to base: base[start:end] is replaced by lines.
+type hunk struct {
+	start, end int
+	lines      []string
+}
+
+// hunks returns the changes that transform base into x.
+func hunks(base, x []string) []hunk {
+	var hs []hunk
+	pos := 0
+	var cur *hunk
+	for _, e := range Diff(base, x) {
+		if e.Op == Equal {
+			if cur != nil {
+				hs = append(hs, *cur)
+				cur = nil
+			}
+			pos++
+			continue
+		}
+		if cur == nil {
+			cur = &hunk{start: pos, end: pos}
+		}
+		if e.Op == Delete {
+			pos++
+			cur.end = pos
+		} else {
+			cur.lines = append(cur.lines, e.Line)
+		}
+	}
+	if cur != nil {
+		hs = append(hs, *cur)
+	}
+	return hs
+}
+
+// apply returns base[start:end] with the changes in hs applied. Each
+// hunk must be within start:end.
+func apply(base []string, start, end int, hs []hunk) []string {
+	var out []string
+	pos := start
+	for _, h := range hs {
+		out = append(out, base[pos:h.start]...)
+		out = append(out, h.lines...)
+		pos = h.end
+	}
+	return append(out, base[pos:end]...)
+}
+
+// Merge3 merges the changes from base to ours and from base to theirs.
+// Changes to the same (or adjacent) lines that are not identical are
+// conflicts, which are included in the result between conflict markers
+// labeled with oursName and theirsName. It returns the merged lines and
+// the number of conflicts.
+func Merge3(base, ours, theirs []string, oursName, theirsName string) ([]string, int) {
+	oh, th := hunks(base, ours), hunks(base, theirs)
+
+	var out []string
+	conflicts := 0
+	pos := 0
+	for len(oh) > 0 || len(th) > 0 {
+		// Start a group with the first hunk, then add any hunks
+		// (from either side) that overlap or touch it.
+		start := len(base)
+		if len(oh) > 0 {
+			start = oh[0].start
+		}
+		if len(th) > 0 && th[0].start < start {
+			start = th[0].start
+		}
+		end := start
+		var og, tg []hunk
+		for {
+			if len(oh) > 0 && oh[0].start <= end {
+				if oh[0].end > end {
+					end = oh[0].end
+				}
+				og, oh = append(og, oh[0]), oh[1:]
+			} else if len(th) > 0 && th[0].start <= end {
+				if th[0].end > end {
+					end = th[0].end
+				}
+				tg, th = append(tg, th[0]), th[1:]
+			} else {
+				break
+			}
+		}
+
+		out = append(out, base[pos:start]...)
+		pos = end
+		o := apply(base, start, end, og)
+		t := apply(base, start, end, tg)
+		switch {
+		case len(tg) == 0:
+			out = append(out, o...)
+		case len(og) == 0, equal(o, t):
+			out = append(out, t...)
+		default:
+			conflicts++
+			out = append(out, "<<<<<<< "+oursName+"\n")
+			out = append(out, terminated(o)...)
+			out = append(out, "=======\n")
+			out = append(out, terminated(t)...)
+			out = append(out, ">>>>>>> "+theirsName+"\n")
+		}
+	}
+	out = append(out, base[pos:]...)
+	return out, conflicts
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// terminated returns lines with a "\n" added to the last line, if
+// needed, so that a conflict marker can follow it.
+func terminated(lines []string) []string {
+	if n := len(lines); n > 0 && lines[n-1][len(lines[n-1])-1] != '\n' {
+		lines = append(lines[:n-1:n-1], lines[n-1]+"\n")
+	}
+	return lines
+}
@@ -0,0 +1,225 @@
+package textdiff
+
+// textdiff -- Line-oriented diffs, computed entirely in memory.
+
+// This exists so that decrypted files can be compared without
+// writing the plaintext to disk for the benefit of "diff".
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Op is the kind of an Edit.
+type Op int
+
+const (
+	// Equal lines are in both a and b.
+	Equal Op = iota
+	// Delete lines are only in a.
+	Delete
+	// Insert lines are only in b.
+	Insert
+)
+
+// Edit is one line of a diff.
+type Edit struct {
+	Op   Op
+	Line string
+}
+
+// Lines splits s into lines. Each line retains its "\n" so that a
+// missing newline at the end of the file is not lost.
+func Lines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	l := strings.SplitAfter(s, "\n")
+	if l[len(l)-1] == "" {
+		l = l[:len(l)-1]
+	}
+	return l
+}
+
+// Diff returns the edits that transform a into b.
+func Diff(a, b []string) []Edit {
+	// Common prefixes and suffixes are the usual case, and cheap to find.
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	var edits []Edit
+	for _, l := range a[:pre] {
+		edits = append(edits, Edit{Equal, l})
+	}
+	edits = append(edits, myers(a[pre:len(a)-suf], b[pre:len(b)-suf])...)
+	for _, l := range a[len(a)-suf:] {
+		edits = append(edits, Edit{Equal, l})
+	}
+	return edits
+}
+
+// myers implements the algorithm in Eugene W. Myers, "An O(ND)
+// Difference Algorithm and Its Variations" (1986).
+func myers(a, b []string) []Edit {
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return nil
+	}
+
+	// v[off+k] is the furthest x reached on diagonal k. trace[d] is
+	// v[off-d-1:off+d+2] as it was before round d, which is needed to
+	// backtrack. Round d reads no other part of v, and keeping only that
+	// window makes the trace O(D²) instead of O(D·(n+m)).
+	off := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+search:
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v[off-d-1:off+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1] // Down (insert).
+			} else {
+				x = v[off+k-1] + 1 // Right (delete).
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// Backtrack from (n,m) to (0,0), collecting the edits in reverse.
+	var rev []Edit
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		w := trace[d] // w[d+1+k] is v[off+k].
+		k := x - y
+		var pk int
+		if k == -d || (k != d && w[d+k] < w[d+k+2]) {
+			pk = k + 1
+		} else {
+			pk = k - 1
+		}
+		px := w[d+1+pk]
+		py := px - pk
+		for x > px && y > py {
+			rev = append(rev, Edit{Equal, a[x-1]})
+			x--
+			y--
+		}
+		if d == 0 {
+			break
+		}
+		if x == px {
+			rev = append(rev, Edit{Insert, b[y-1]})
+			y--
+		} else {
+			rev = append(rev, Edit{Delete, a[x-1]})
+			x--
+		}
+	}
+
+	edits := make([]Edit, len(rev))
+	for i, e := range rev {
+		edits[len(rev)-1-i] = e
+	}
+	return edits
+}
+
+// Unified returns a diff of a and b in the unified format of "diff -u",
+// with context lines of context around each change. The result is ""
+// if a and b are the same.
+func Unified(aname, bname string, a, b []string, context int) string {
+	edits := Diff(a, b)
+
+	// apos[i] and bpos[i] count the lines of a and b before edits[i].
+	apos := make([]int, len(edits)+1)
+	bpos := make([]int, len(edits)+1)
+	for i, e := range edits {
+		apos[i+1], bpos[i+1] = apos[i], bpos[i]
+		if e.Op != Insert {
+			apos[i+1]++
+		}
+		if e.Op != Delete {
+			bpos[i+1]++
+		}
+	}
+
+	var out strings.Builder
+	i := 0
+	for {
+		// Find the next change.
+		for i < len(edits) && edits[i].Op == Equal {
+			i++
+		}
+		if i == len(edits) {
+			break
+		}
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", aname, bname)
+		}
+
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		// Extend the hunk until the changes are more than 2*context apart.
+		end := i
+		for {
+			for end < len(edits) && edits[end].Op != Equal {
+				end++
+			}
+			next := end
+			for next < len(edits) && edits[next].Op == Equal {
+				next++
+			}
+			if next < len(edits) && next-end <= 2*context {
+				end = next
+				continue
+			}
+			end += context
+			if end > len(edits) {
+				end = len(edits)
+			}
+			break
+		}
+
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n",
+			hunkRange(apos[start], apos[end]-apos[start]),
+			hunkRange(bpos[start], bpos[end]-bpos[start]))
+		for _, e := range edits[start:end] {
+			out.WriteString([]string{" ", "-", "+"}[e.Op])
+			out.WriteString(e.Line)
+			if !strings.HasSuffix(e.Line, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = end
+	}
+	return out.String()
+}
+
+// hunkRange formats the "start,length" of a hunk header.
+func hunkRange(start, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
@@ -0,0 +1,129 @@
+package textdiff
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	for i, test := range []struct {
+		a, b     string
+		expected string
+	}{
+		{"", "", ""},
+		{"same\n", "same\n", ""},
+		{"", "new\n", "--- a\n+++ b\n@@ -0,0 +1 @@\n+new\n"},
+		{"old\n", "", "--- a\n+++ b\n@@ -1 +0,0 @@\n-old\n"},
+		{"one\ntwo\nthree\n", "one\n2\nthree\n",
+			"--- a\n+++ b\n@@ -1,3 +1,3 @@\n one\n-two\n+2\n three\n"},
+		{"one\n", "one",
+			"--- a\n+++ b\n@@ -1 +1 @@\n-one\n+one\n\\ No newline at end of file\n"},
+		// Changes far apart are separate hunks.
+		{"1\n2\n3\n4\n5\n6\n7\n8\n9\n", "x\n2\n3\n4\n5\n6\n7\n8\ny\n",
+			"--- a\n+++ b\n@@ -1,2 +1,2 @@\n-1\n+x\n 2\n@@ -8,2 +8,2 @@\n 8\n-9\n+y\n"},
+		// Changes close together are one hunk.
+		{"1\n2\n3\n4\n", "x\n2\n3\ny\n",
+			"--- a\n+++ b\n@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n-4\n+y\n"},
+		{"a\nb\nc\nd\n", "b\nc\ne\nd\n",
+			"--- a\n+++ b\n@@ -1,4 +1,4 @@\n-a\n b\n c\n+e\n d\n"},
+	} {
+		g := Unified("a", "b", Lines(test.a), Lines(test.b), 1)
+		if g == test.expected {
+			t.Logf("%03d: PASSED", i)
+		} else {
+			t.Errorf("%03d: FAILED a=%q b=%q\ngot:\n%s\nwanted:\n%s", i, test.a, test.b, g, test.expected)
+		}
+	}
+}
+
+func TestDiffReconstructs(t *testing.T) {
+	a := Lines("the\nquick\nbrown\nfox\njumps\nover\nthe\nlazy\ndog\n")
+	b := Lines("a\nquick\nfox\njumps\nhigh\nover\nthe\ndog\ncat\n")
+	var ga, gb []string
+	for _, e := range Diff(a, b) {
+		if e.Op != Insert {
+			ga = append(ga, e.Line)
+		}
+		if e.Op != Delete {
+			gb = append(gb, e.Line)
+		}
+	}
+	if len(ga) != len(a) || len(gb) != len(b) {
+		t.Fatalf("wrong lengths: %q %q", ga, gb)
+	}
+	for i := range a {
+		if a[i] != ga[i] {
+			t.Errorf("a[%d]: got %q wanted %q", i, ga[i], a[i])
+		}
+	}
+	for i := range b {
+		if b[i] != gb[i] {
+			t.Errorf("b[%d]: got %q wanted %q", i, gb[i], b[i])
+		}
+	}
+}
+
+func TestDiffLarge(t *testing.T) {
+	// 200 changes scattered over 100000 lines: D is small, n+m is not.
+	var a, b []string
+	for i := 0; i < 100000; i++ {
+		l := fmt.Sprintf("line %d\n", i)
+		a = append(a, l)
+		if i%500 == 250 {
+			l = fmt.Sprintf("changed %d\n", i)
+		}
+		b = append(b, l)
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	edits := Diff(a, b)
+	runtime.ReadMemStats(&after)
+
+	count := map[Op]int{}
+	for _, e := range edits {
+		count[e.Op]++
+	}
+	if count[Equal] != 99800 || count[Delete] != 200 || count[Insert] != 200 {
+		t.Errorf("wrong edits: %v", count)
+	}
+	// Copying all of v each round would allocate over 1GB.
+	if g := after.TotalAlloc - before.TotalAlloc; g > 64<<20 {
+		t.Errorf("Diff allocated %d bytes", g)
+	}
+}
+
+func TestMerge3(t *testing.T) {
+	for i, test := range []struct {
+		base, ours, theirs string
+		expected           string
+		conflicts          int
+	}{
+		{"a\nb\nc\n", "a\nb\nc\n", "a\nb\nc\n", "a\nb\nc\n", 0},
+		{"a\nb\nc\n", "A\nb\nc\n", "a\nb\nc\n", "A\nb\nc\n", 0},
+		{"a\nb\nc\n", "a\nb\nc\n", "a\nb\nC\n", "a\nb\nC\n", 0},
+		{"a\nb\nc\n", "A\nb\nc\n", "a\nb\nC\n", "A\nb\nC\n", 0},
+		{"a\nb\nc\n", "a\nB\nc\n", "a\nB\nc\n", "a\nB\nc\n", 0},
+		{"", "a\n", "", "a\n", 0},
+		{"a\nc\n", "a\nb\nc\n", "a\nc\nd\n", "a\nb\nc\nd\n", 0},
+		{"a\nb\nc\nd\n", "a\nc\nd\n", "a\nb\nc\n", "a\nc\n", 0},
+		{"a\nb\nc\n", "a\nX\nc\n", "a\nY\nc\n",
+			"a\n<<<<<<< ours\nX\n=======\nY\n>>>>>>> theirs\nc\n", 1},
+		// Adjacent changes conflict.
+		{"a\nb\n", "A\nb\n", "a\nB\n",
+			"<<<<<<< ours\nA\nb\n=======\na\nB\n>>>>>>> theirs\n", 1},
+		{"", "x", "y", "<<<<<<< ours\nx\n=======\ny\n>>>>>>> theirs\n", 1},
+	} {
+		g, c := Merge3(Lines(test.base), Lines(test.ours), Lines(test.theirs), "ours", "theirs")
+		gs := ""
+		for _, l := range g {
+			gs += l
+		}
+		if gs == test.expected && c == test.conflicts {
+			t.Logf("%03d: PASSED", i)
+		} else {
+			t.Errorf("%03d: FAILED\ngot (%d):\n%s\nwanted (%d):\n%s", i, c, gs, test.conflicts, test.expected)
+		}
+	}
+}
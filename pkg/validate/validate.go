@@ -0,0 +1,140 @@
+// Package validate checks that the plaintext of a file is well-formed
+// (i.e. that a YAML file parses) before it is encrypted.
+package validate
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"github.com/StackExchange/blackbox/v2/pkg/bbutil"
+	"github.com/StackExchange/blackbox/v2/pkg/dotenv"
+)
+
+// checkers are the built-in validators, by type.
+var checkers = map[string]func([]byte) error{
+	"json":   checkJSON,
+	"yaml":   checkYAML,
+	"toml":   checkTOML,
+	"dotenv": checkDotenv,
+	"pem":    checkPEM,
+}
+
+// Types returns the names of the built-in validators.
+func Types() []string {
+	return []string{"dotenv", "json", "pem", "toml", "yaml"}
+}
+
+// Check checks data with the built-in validator typ.
+func Check(typ string, data []byte) error {
+	c, ok := checkers[typ]
+	if !ok {
+		return fmt.Errorf("unknown validator type %q (expected one of %s)", typ, strings.Join(Types(), ", "))
+	}
+	return c(data)
+}
+
+// Command checks data by running command (split into words like a
+// shell would, but not run by one) with data on its stdin. $BLACKBOX_FILE
+// is set to name. A non-zero exit means data is invalid; the command's
+// output is the explanation.
+func Command(command, name string, data []byte) error {
+	words, err := bbutil.ShellWords(command)
+	if err != nil {
+		return err
+	}
+	if len(words) == 0 {
+		return fmt.Errorf("empty validator command")
+	}
+	cmd := exec.Command(words[0], words[1:]...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Env = append(os.Environ(), "BLACKBOX_FILE="+name)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%s: %s", words[0], msg)
+		}
+		return fmt.Errorf("%s: %w", words[0], err)
+	}
+	return nil
+}
+
+func checkJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		if se, ok := err.(*json.SyntaxError); ok {
+			return fmt.Errorf("line %d: %w", lineOf(data, int(se.Offset)), err)
+		}
+		return err
+	}
+	return nil
+}
+
+func checkYAML(data []byte) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var n yaml.Node
+		err := dec.Decode(&n)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func checkTOML(data []byte) error {
+	var v map[string]interface{}
+	return toml.Unmarshal(data, &v)
+}
+
+func checkDotenv(data []byte) error {
+	_, err := dotenv.Parse(data)
+	return err
+}
+
+// checkPEM checks that data has at least one PEM block, and nothing but
+// whitespace outside of the blocks.
+func checkPEM(data []byte) error {
+	found := false
+	rest := data
+	for {
+		start := bytes.Index(rest, []byte("-----BEGIN "))
+		if start == -1 {
+			break
+		}
+		if len(bytes.TrimSpace(rest[:start])) != 0 {
+			return fmt.Errorf("line %d: text outside of a PEM block", lineOf(data, len(data)-len(rest)))
+		}
+		block, r := pem.Decode(rest[start:])
+		if block == nil {
+			return fmt.Errorf("line %d: invalid PEM block", lineOf(data, len(data)-len(rest)+start))
+		}
+		found = true
+		rest = r
+	}
+	if len(bytes.TrimSpace(rest)) != 0 {
+		return fmt.Errorf("line %d: text outside of a PEM block", lineOf(data, len(data)-len(rest)))
+	}
+	if !found {
+		return fmt.Errorf("no PEM block found")
+	}
+	return nil
+}
+
+// lineOf returns the line number of offset in data.
+func lineOf(data []byte, offset int) int {
+	if offset > len(data) {
+		offset = len(data)
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
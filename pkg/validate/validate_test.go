@@ -0,0 +1,121 @@
+package validate
+
+import (
+	"testing"
+)
+
+const testPEM = `-----BEGIN TEST-----
+aGVsbG8=
+-----END TEST-----
+`
+
+const testTOML = `# A comment.
+title = "TOML \"Example\"" # Trailing.
+"quoted key" = 'C:\path'
+dotted.key = 1_000
+multi = """
+one \
+  two"""
+lit = '''
+raw \n'''
+
+[owner]
+dob = 1979-05-27T07:32:00-08:00
+day = 1979-05-27
+at = 07:32:00.5
+local = 1979-05-27 07:32:00
+
+[database]
+ports = [ 8000, 8001,
+  8002, # comment
+]
+data = [ ["a", "b"], [1.0, -2e5, inf, nan] ]
+enabled = true
+hex = 0xDEAD_beef
+temp = { cpu = 79.5, case.inner = 72 }
+
+[servers.alpha]
+ip = "10.0.0.1"
+
+[fruit]
+apple.color = "red"
+
+[fruit.apple.texture]
+smooth = true
+
+[[products]]
+name = "Hammer"
+
+[[products]]
+name = "Nail"
+
+[products.details]
+size = 2
+`
+
+func TestCheck(t *testing.T) {
+	for i, test := range []struct {
+		typ, data string
+	}{
+		{"json", `{"a": [1, 2]}`},
+		{"yaml", "a: 1\n---\nb: [1, 2]\n"},
+		{"yaml", ""},
+		{"dotenv", "A=1\n# c\nB='x y'\n"},
+		{"pem", testPEM},
+		{"pem", "\n" + testPEM + "\n" + testPEM},
+		{"toml", ""},
+		{"toml", testTOML},
+		{"toml", "a = 1\r\nb = 2\r\n"},
+	} {
+		if err := Check(test.typ, []byte(test.data)); err != nil {
+			t.Errorf("%03d: %s %q: error: %v", i, test.typ, test.data, err)
+		}
+	}
+
+	for i, test := range []struct {
+		typ, data string
+	}{
+		{"json", `{"a": [1, 2}`},
+		{"json", ``},
+		{"yaml", "a: 1\n b: 2\n"},
+		{"yaml", "a: [1, 2\n"},
+		{"dotenv", "A B=1\n"},
+		{"pem", ""},
+		{"pem", "junk\n" + testPEM},
+		{"pem", testPEM + "junk\n"},
+		{"pem", "-----BEGIN TEST-----\n!!!\n-----END TEST-----\n"},
+		{"toml", "a = 1\na = 2\n"},
+		{"toml", "[a]\n[a]\n"},
+		{"toml", "a = 1\n[a]\n"},
+		{"toml", "a.b = 1\n[a.b]\n"},
+		{"toml", "a = \n"},
+		{"toml", "a = 01\n"},
+		{"toml", "a = 1 2\n"},
+		{"toml", "a = \"unterminated\n"},
+		{"toml", "a = \"\\q\"\n"},
+		{"toml", "a = [1, 2\n"},
+		{"toml", "a = {b = 1,}\n"},
+		{"toml", "a = {b = 1}\n[a]\n"},
+		{"toml", "[a\n"},
+		{"toml", "= 1\n"},
+		{"toml", "a = true false\n"},
+		{"toml", "a = 1979-05-27T07:32\n"},
+		{"nope", "x"},
+	} {
+		if err := Check(test.typ, []byte(test.data)); err == nil {
+			t.Errorf("%03d: %s %q: expected an error", i, test.typ, test.data)
+		}
+	}
+}
+
+func TestCommand(t *testing.T) {
+	if err := Command("grep -q secret", "x", []byte("a secret\n")); err != nil {
+		t.Errorf("expected success: %v", err)
+	}
+	if err := Command("grep -q secret", "x", []byte("nothing\n")); err == nil {
+		t.Errorf("expected an error")
+	}
+	if err := Command(`sh -c 'test "$BLACKBOX_FILE" = x/y'`, "x/y", nil); err != nil {
+		t.Errorf("BLACKBOX_FILE not set: %v", err)
+	}
+}
@@ -1,7 +1,10 @@
 package git
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 
@@ -22,6 +25,7 @@ type VcsHandle struct {
 	commitTitle         string
 	commitHeaderPrinted bool              // Has the "NEXT STEPS" header been printed?
 	toCommit            *commitlater.List // List of future commits
+	dryRun              bool              // Only say what would be changed.
 }
 
 func newGit() (vcs.Vcs, error) {
@@ -34,6 +38,12 @@ func (v VcsHandle) Name() string {
 	return pluginName
 }
 
+// SetDryRun makes the methods that would change the repo only say what
+// they would do.
+func (v *VcsHandle) SetDryRun(dryRun bool) {
+	v.dryRun = dryRun
+}
+
 func ultimate(s string) int { return len(s) - 1 }
 
 // Discover returns true if we are a repo of this type; along with the Abs path to the repo root (or "" if we don't know).
@@ -52,58 +62,58 @@ func (v VcsHandle) Discover() (bool, string) {
 	return err == nil, out
 }
 
-// SetFileTypeUnix informs the VCS that files should maintain unix-style line endings.
-func (v VcsHandle) SetFileTypeUnix(repobasedir string, files ...string) error {
-	seen := make(map[string]bool)
+// SetDiffDriver tells git to display diffs of files using the text command outputs.
+// The driver is configured in the local (.git/config) configuration only.
+// Other users see the usual "Binary files differ" until they run
+// the same command.
+func (v VcsHandle) SetDiffDriver(repobasedir string, driver string, command string) error {
+	return v.config(repobasedir, "diff."+driver+".textconv", command)
+}
 
-	// Add to the .gitattributes in the same directory as the file.
-	for _, file := range files {
-		d, n := filepath.Split(file)
-		af := filepath.Join(repobasedir, d, ".gitattributes")
-		err := bbutil.Touch(af)
-		if err != nil {
-			return err
-		}
-		err = bbutil.AddLinesToFile(af, fmt.Sprintf("%q text eol=lf", n))
+// config sets key to value in the local configuration.
+func (v VcsHandle) config(repobasedir, key, value string) error {
+	if v.dryRun {
+		bbutil.DryRunf("would run: git config %s %s", key, makesafe.Shell(value))
+		return nil
+	}
+	return bbutil.RunBash("git", "-C", repobasedir, "config", key, value)
+}
+
+// SetFilterDriver tells git to run files through clean (on checkin) and
+// smudge (on checkout) commands. Like SetDiffDriver, the driver is
+// configured in the local configuration only. The filter is marked
+// "required" so that git fails rather than checking in plaintext if
+// a command fails.
+func (v VcsHandle) SetFilterDriver(repobasedir string, driver string, clean string, smudge string) error {
+	for _, kv := range [][2]string{
+		{"filter." + driver + ".clean", clean},
+		{"filter." + driver + ".smudge", smudge},
+		{"filter." + driver + ".required", "true"},
+	} {
+		err := v.config(repobasedir, kv[0], kv[1])
 		if err != nil {
 			return err
 		}
-		seen[af] = true
 	}
-
-	var changedfiles []string
-	for k := range seen {
-		changedfiles = append(changedfiles, k)
-	}
-
-	v.NeedsCommit(
-		"set gitattr=UNIX "+strings.Join(makesafe.RedactMany(files), " "),
-		repobasedir,
-		changedfiles,
-	)
-
 	return nil
 }
 
-// IgnoreAnywhere tells the VCS to ignore these files anywhere rin the repo.
-func (v VcsHandle) IgnoreAnywhere(repobasedir string, files []string) error {
-	// Add to the .gitignore file in the repobasedir.
-	ignore := filepath.Join(repobasedir, ".gitignore")
-	err := bbutil.Touch(ignore)
-	if err != nil {
-		return err
-	}
-
-	err = bbutil.AddLinesToFile(ignore, files...)
-	if err != nil {
-		return err
+// SetMergeDriver tells git to merge files using command. Git replaces
+// %O, %A and %B with the names of temporary files that contain the
+// base, ours and theirs versions, and %P with the file's name. The
+// command writes the result to %A, and fails if there are conflicts.
+// Like SetDiffDriver, the driver is configured in the local
+// configuration only. Other users get git's usual merge.
+func (v VcsHandle) SetMergeDriver(repobasedir string, driver string, command string) error {
+	for _, kv := range [][2]string{
+		{"merge." + driver + ".name", "blackbox merge of encrypted and registry files"},
+		{"merge." + driver + ".driver", command},
+	} {
+		err := v.config(repobasedir, kv[0], kv[1])
+		if err != nil {
+			return err
+		}
 	}
-
-	v.NeedsCommit(
-		"gitignore "+strings.Join(makesafe.RedactMany(files), " "),
-		repobasedir,
-		[]string{".gitignore"},
-	)
 	return nil
 }
 
@@ -129,47 +139,163 @@ func gitSafeFilename(name string) string {
 	return b.String()
 }
 
-// IgnoreFiles tells the VCS to ignore these files, specified relative to RepoBaseDir.
-func (v VcsHandle) IgnoreFiles(repobasedir string, files []string) error {
+// Remove tells git to stop tracking files, and removes them from disk.
+// Files that git never tracked are simply removed.
+func (v VcsHandle) Remove(repobasedir string, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	if v.dryRun {
+		for _, name := range names {
+			bbutil.DryRunf("would remove %q", filepath.Join(repobasedir, name))
+		}
+		return nil
+	}
+	err := bbutil.RunBash("git", append([]string{"--literal-pathspecs", "-C", repobasedir,
+		"rm", "--cached", "--quiet", "--ignore-unmatch", "--"}, names...)...)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		err := os.Remove(filepath.Join(repobasedir, name))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
 
-	var lines []string
-	for _, f := range files {
-		lines = append(lines, "/"+gitSafeFilename(f))
+// Rename moves a file with "git mv", so that git follows its history.
+// Files that git doesn't track are simply moved.
+func (v VcsHandle) Rename(repobasedir string, oldname, newname string) error {
+	if v.dryRun {
+		bbutil.DryRunf("would move %q to %q", filepath.Join(repobasedir, oldname), filepath.Join(repobasedir, newname))
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Join(repobasedir, filepath.Dir(newname)), 0o750); err != nil {
+		return err
+	}
+	out, err := bbutil.RunBashOutput("git", "--literal-pathspecs", "-C", repobasedir,
+		"ls-files", "-z", "--", oldname)
+	if err != nil {
+		return fmt.Errorf("git can not check %q: %w", oldname, err)
 	}
+	if out == "" {
+		return os.Rename(filepath.Join(repobasedir, oldname), filepath.Join(repobasedir, newname))
+	}
+	return bbutil.RunBash("git", "--literal-pathspecs", "-C", repobasedir,
+		"mv", "--", oldname, newname)
+}
 
-	// Add to the .gitignore file in the repobasedir.
-	ignore := filepath.Join(repobasedir, ".gitignore")
-	err := bbutil.Touch(ignore)
+// FileHistory reports whether git tracks a file and lists the commits (in any branch) that touched it.
+func (v VcsHandle) FileHistory(repobasedir string, name string) (bool, []string, error) {
+	// --literal-pathspecs because "*.go" is a valid (if unwise) filename.
+	out, err := bbutil.RunBashOutput("git", "--literal-pathspecs", "-C", repobasedir,
+		"ls-files", "-z", "--", name)
 	if err != nil {
-		return err
+		return false, nil, fmt.Errorf("git can not check %q: %w", name, err)
 	}
-	err = bbutil.AddLinesToFile(ignore, lines...)
+	tracked := out != ""
+
+	out, err = bbutil.RunBashOutput("git", "--literal-pathspecs", "-C", repobasedir,
+		"log", "--all", "--date=short", "--format=%h %ad %an: %s", "--", name)
 	if err != nil {
-		return err
+		// A repo with no commits has no history.
+		return tracked, nil, nil
 	}
+	out = strings.TrimSuffix(out, "\n")
+	if out == "" {
+		return tracked, nil, nil
+	}
+	return tracked, strings.Split(out, "\n"), nil
+}
 
-	v.NeedsCommit(
-		"gitignore "+strings.Join(makesafe.RedactMany(files), " "),
-		repobasedir,
-		[]string{".gitignore"},
-	)
-	return nil
+// TrackedFiles lists the files in the index: those that are committed
+// or staged to be, less those staged for removal.
+func (v VcsHandle) TrackedFiles(repobasedir string) ([]string, error) {
+	out, err := bbutil.RunBashOutput("git", "-C", repobasedir, "ls-files", "-z")
+	if err != nil {
+		return nil, fmt.Errorf("git can not list the tracked files: %w", err)
+	}
+	var files []string
+	for _, f := range strings.Split(out, "\x00") {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files, nil
 }
 
-// Add makes a file visible to the VCS (like "git add").
-func (v VcsHandle) Add(repobasedir string, files []string) error {
+// NeedsUntrack queues up telling git to stop tracking files (relative to
+// repobasedir), without removing them from disk.
+func (v *VcsHandle) NeedsUntrack(message string, repobasedir string, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	v.toCommit.Untrack(message, repobasedir, names)
+}
 
-	if len(files) == 0 {
+// untrack removes files (relative to repobasedir) from the index, but not
+// from disk.
+func untrack(repobasedir string, names []string) error {
+	if len(names) == 0 {
 		return nil
 	}
+	return bbutil.RunBash("git", append([]string{"--literal-pathspecs", "-C", repobasedir,
+		"rm", "--cached", "--quiet", "--"}, names...)...)
+}
 
-	// TODO(tlim): Make sure that files are within repobasedir.
+// Ignored returns the names that .gitignore (etc.) ignores, whether or
+// not git tracks them.
+func (v VcsHandle) Ignored(repobasedir string, names []string) ([]string, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	in := strings.Join(names, "\x00") + "\x00"
+	out, err := bbutil.RunBashInputOutput([]byte(in), "git", "-C", repobasedir,
+		"check-ignore", "--no-index", "--stdin", "-z")
+	var ee *exec.ExitError
+	if errors.As(err, &ee) && ee.ExitCode() == 1 {
+		return nil, nil // None are ignored.
+	}
+	if err != nil {
+		return nil, fmt.Errorf("git can not check ignores: %w", err)
+	}
+	var ignored []string
+	for _, f := range strings.Split(string(out), "\x00") {
+		if f != "" {
+			ignored = append(ignored, f)
+		}
+	}
+	return ignored, nil
+}
+
+// StagedFiles lists the files (relative to repobasedir) that will be added or changed by the next commit.
+func (v VcsHandle) StagedFiles(repobasedir string) ([]string, error) {
+	// Deleted files are excluded. Removing a file from the index is never a leak.
+	out, err := bbutil.RunBashOutput("git", "-C", repobasedir,
+		"diff", "--cached", "--name-only", "--diff-filter=ACMR", "-z")
+	if err != nil {
+		return nil, fmt.Errorf("git can not list staged files: %w", err)
+	}
+	var files []string
+	for _, f := range strings.Split(out, "\x00") {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
 
-	var gpgnames []string
-	for _, n := range files {
-		gpgnames = append(gpgnames, n+".gpg")
+// CatStaged returns the contents of a file as it will be committed.
+func (v VcsHandle) CatStaged(repobasedir string, name string) ([]byte, error) {
+	// "git cat-file" never runs textconv filters, thus we get the raw blob.
+	// Silent because "not staged" is a normal result for callers to handle.
+	out, err := bbutil.RunBashOutputSilent("git", "-C", repobasedir, "cat-file", "blob", ":"+name)
+	if err != nil {
+		return nil, fmt.Errorf("git can not read staged %q: %w", name, err)
 	}
-	return bbutil.RunBash("git", append([]string{"add"}, gpgnames...)...)
+	return []byte(out), nil
 }
 
 // CommitTitle indicates what the next commit title will be.
@@ -190,11 +316,25 @@ func (v VcsHandle) DebugCommits() commitlater.List {
 
 // FlushCommits informs the VCS to do queued up commits.
 func (v VcsHandle) FlushCommits() error {
+	fadd, funtrack := stage, untrack
+	if v.dryRun {
+		fadd = func(repobasedir string, files []string) error {
+			for _, f := range files {
+				bbutil.DryRunf("would stage %q", f)
+			}
+			return nil
+		}
+		funtrack = func(repobasedir string, names []string) error {
+			for _, name := range names {
+				bbutil.DryRunf("would stop tracking %q", filepath.Join(repobasedir, name))
+			}
+			return nil
+		}
+	}
 	return v.toCommit.Flush(
 		v.commitTitle,
-		func(files []string) error {
-			return bbutil.RunBash("git", append([]string{"add"}, files...)...)
-		},
+		fadd,
+		funtrack,
 		v.suggestCommit,
 	)
 	// TODO(tlim): Some day we can add a command line flag that indicates that commits are
@@ -203,14 +343,60 @@ func (v VcsHandle) FlushCommits() error {
 	// of suggesting them.  Flag could be called --commit=auto vs --commit=suggest.
 }
 
+// stage adds files (relative to the cwd) to the index of the repo at
+// repobasedir. Files that no longer exist are removed from it. (git add
+// fails for a file that is in neither.) git is run in repobasedir, which
+// may be a submodule of the repo the cwd is in.
+func stage(repobasedir string, files []string) error {
+	base, err := filepath.Abs(repobasedir)
+	if err != nil {
+		return err
+	}
+	var add, rm []string
+	for _, f := range files {
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(base, abs)
+		if err != nil {
+			return fmt.Errorf("%q is not in the repo %q: %w", f, repobasedir, err)
+		}
+		if _, err := os.Lstat(f); err == nil {
+			add = append(add, rel)
+		} else {
+			rm = append(rm, rel)
+		}
+	}
+	if len(add) != 0 {
+		args := []string{"-C", repobasedir, "--literal-pathspecs", "add", "--"}
+		if err := bbutil.RunBash("git", append(args, add...)...); err != nil {
+			return err
+		}
+	}
+	if len(rm) != 0 {
+		args := []string{"-C", repobasedir, "--literal-pathspecs", "rm", "--cached", "--quiet", "--ignore-unmatch", "--"}
+		return bbutil.RunBash("git", append(args, rm...)...)
+	}
+	return nil
+}
+
 // suggestCommit tells the user what commits are needed.
-func (v *VcsHandle) suggestCommit(messages []string, repobasedir string, files []string) error {
+func (v *VcsHandle) suggestCommit(messages []string, repobasedir string, files []string, untracked []string) error {
 	if !v.commitHeaderPrinted {
 		fmt.Printf("NEXT STEP: You need to manually check these in:\n")
 	}
 	v.commitHeaderPrinted = true
 
 	fmt.Print(`     git commit -m'`, strings.Join(messages, `' -m'`)+`'`)
+	if len(untracked) != 0 {
+		// Given paths, git commit would add the untracked files back
+		// from the disk. Everything is staged, so commit the index.
+		fmt.Println()
+		fmt.Printf("     (This commits everything that is staged, which includes removing %s from git.)\n",
+			strings.Join(makesafe.ShellMany(untracked), " "))
+		return nil
+	}
 	fmt.Print(" ")
 	fmt.Print(strings.Join(makesafe.ShellMany(files), " "))
 	fmt.Println()
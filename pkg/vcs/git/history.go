@@ -0,0 +1,133 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/StackExchange/blackbox/v2/models"
+	"github.com/StackExchange/blackbox/v2/pkg/bbutil"
+)
+
+// logFormat is the git log --format of a commit: its fields separated by
+// US (unit separator) characters.
+const logFormat = "%H%x1f%an <%ae>%x1f%aI%x1f%s"
+
+// WalkHistory calls fn for every commit reachable from any branch or tag,
+// with the files that commit added or changed.
+func (v VcsHandle) WalkHistory(repobasedir string, fn func(c models.Commit, files []models.TreeEntry) error) error {
+	// One stream for the whole history: each commit is followed by its
+	// raw diff. -c includes what merges changed relative to all parents.
+	out, err := bbutil.RunBashOutput("git", "-C", repobasedir,
+		"log", "--all", "-z", "--raw", "-c", "--no-abbrev", "--no-renames",
+		"--format="+logFormat)
+	if err != nil {
+		return fmt.Errorf("git can not list commits: %w", err)
+	}
+
+	for _, c := range parseLog(out) {
+		if err := fn(c.commit, c.files); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// logCommit is a commit and the files it added or changed.
+type logCommit struct {
+	commit models.Commit
+	files  []models.TreeEntry
+}
+
+// parseLog parses the output of git log -z --raw -c --no-abbrev
+// --no-renames with logFormat. Deleted files and submodules are skipped.
+func parseLog(out string) []logCommit {
+	// Each commit is "header NUL" followed by "meta NUL path NUL" for
+	// each file. Meta is ":oldmode newmode oldsha newsha status", with
+	// one more colon, mode and sha for each additional parent of a merge.
+	var commits []logCommit
+	recs := strings.Split(out, "\x00")
+	for i := 0; i < len(recs); i++ {
+		rec := strings.TrimPrefix(recs[i], "\n")
+		if strings.HasPrefix(rec, ":") {
+			i++ // The path is the next record.
+			if i == len(recs) || len(commits) == 0 {
+				break
+			}
+			meta := strings.Fields(strings.TrimLeft(rec, ":"))
+			if len(meta) < 5 || len(meta)%2 == 0 {
+				continue
+			}
+			mode, hash := meta[len(meta)/2-1], meta[len(meta)-2]
+			if mode == "000000" || mode == "160000" {
+				continue // Deleted, or a submodule.
+			}
+			c := &commits[len(commits)-1]
+			c.files = append(c.files, models.TreeEntry{Name: recs[i], Hash: hash})
+			continue
+		}
+		f := strings.SplitN(rec, "\x1f", 4)
+		if len(f) != 4 {
+			continue
+		}
+		commits = append(commits, logCommit{
+			commit: models.Commit{ID: f[0], Author: f[1], Date: f[2], Subject: f[3]},
+		})
+	}
+	return commits
+}
+
+// HashContent returns the blob ID git would give a file containing data.
+func (v VcsHandle) HashContent(repobasedir string, data []byte) (string, error) {
+	out, err := bbutil.RunBashInputOutput(data, "git", "-C", repobasedir, "hash-object", "--stdin")
+	if err != nil {
+		return "", fmt.Errorf("git can not hash: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// FileLog lists the commits that changed a file, newest first, following renames.
+func (v VcsHandle) FileLog(repobasedir string, name string) ([]models.FileVersion, error) {
+	out, err := bbutil.RunBashOutput("git", "--literal-pathspecs", "-C", repobasedir,
+		"log", "--follow", "-z", "--name-only",
+		"--format="+logFormat, "--", name)
+	if err != nil {
+		return nil, fmt.Errorf("git can not list commits of %q: %w", name, err)
+	}
+	return parseFileLog(out, name), nil
+}
+
+// parseFileLog parses the output of git log --follow -z --name-only with
+// logFormat for name. Each version gets the name the file had then.
+func parseFileLog(out, name string) []models.FileVersion {
+	// Each commit is "header NUL" followed by "LF name NUL" for each
+	// file. Merges may have no file.
+	var versions []models.FileVersion
+	for _, rec := range strings.Split(out, "\x00") {
+		if strings.HasPrefix(rec, "\n") && len(versions) > 0 {
+			versions[len(versions)-1].Name = rec[1:]
+			continue
+		}
+		f := strings.SplitN(rec, "\x1f", 4)
+		if len(f) != 4 {
+			continue
+		}
+		n := name
+		if len(versions) > 0 {
+			n = versions[len(versions)-1].Name
+		}
+		versions = append(versions, models.FileVersion{
+			Commit: models.Commit{ID: f[0], Author: f[1], Date: f[2], Subject: f[3]},
+			Name:   n,
+		})
+	}
+	return versions
+}
+
+// CatRevision returns the contents of a file as of a revision.
+func (v VcsHandle) CatRevision(repobasedir string, rev string, name string) ([]byte, error) {
+	out, err := bbutil.RunBashOutputSilent("git", "-C", repobasedir, "cat-file", "blob", rev+":"+name)
+	if err != nil {
+		return nil, fmt.Errorf("git can not find %q in %q: %w", name, rev, err)
+	}
+	return []byte(out), nil
+}
@@ -0,0 +1,72 @@
+package git
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/StackExchange/blackbox/v2/models"
+)
+
+// rec is a commit as formatted by git log --format=logFormat.
+func rec(id, subject string) string {
+	return id + "\x1fAl <al@example.com>\x1f2020-01-02T03:04:05+00:00\x1f" + subject
+}
+
+func commit(id, subject string) models.Commit {
+	return models.Commit{ID: id, Author: "Al <al@example.com>", Date: "2020-01-02T03:04:05+00:00", Subject: subject}
+}
+
+func TestParseLog(t *testing.T) {
+	const zero = "0000000000000000000000000000000000000000"
+	raw := func(old, new, oldHash, newHash, status, path string) string {
+		return ":" + old + " " + new + " " + oldHash + " " + newHash + " " + status + "\x00" + path + "\x00"
+	}
+	type files = []models.TreeEntry
+	for i, test := range []struct {
+		out      string
+		expected []logCommit
+	}{
+		{"", nil},
+		{rec("c3", "third") + "\x00", []logCommit{{commit("c3", "third"), nil}}},
+		{rec("c2", "second: with\x1fUS") + "\x00\n" + raw("100644", "100644", "0f7b", "c1b0", "M", "b.txt") +
+			raw("000000", "100755", zero, "5e5e", "A", "we ird\tname") + rec("c1", "first") + "\x00",
+			[]logCommit{
+				{commit("c2", "second: with\x1fUS"), files{{Name: "b.txt", Hash: "c1b0"}, {Name: "we ird\tname", Hash: "5e5e"}}},
+				{commit("c1", "first"), nil}}},
+		// Deletions and submodules are skipped. Symlinks are kept.
+		{rec("c1", "first") + "\x00\n" + raw("100644", "000000", "0f7b", zero, "D", "gone.txt") +
+			raw("000000", "160000", zero, "9a9a", "A", "sub") + raw("000000", "120000", zero, "5e5e", "A", "link") +
+			raw("000000", "100644", zero, "0f7b", "A", "line\nbreak"),
+			[]logCommit{{commit("c1", "first"), files{{Name: "link", Hash: "5e5e"}, {Name: "line\nbreak", Hash: "0f7b"}}}}},
+		// A merge lists the files that differ from all parents.
+		{rec("c3", "merge") + "\x00\x00::000000 000000 100644 " + zero + " " + zero + " 53c7 AA\x00e.txt\x00",
+			[]logCommit{{commit("c3", "merge"), files{{Name: "e.txt", Hash: "53c7"}}}}},
+		{"garbage\x00" + rec("c1", "") + "\x00", []logCommit{{commit("c1", ""), nil}}},
+	} {
+		if g := parseLog(test.out); fmt.Sprint(g) != fmt.Sprint(test.expected) {
+			t.Errorf("%03d: FAILED %q: got=%v wanted=%v", i, test.out, g, test.expected)
+		}
+	}
+}
+
+func TestParseFileLog(t *testing.T) {
+	v := func(c models.Commit, name string) models.FileVersion {
+		return models.FileVersion{Commit: c, Name: name}
+	}
+	for i, test := range []struct {
+		out      string
+		expected []models.FileVersion
+	}{
+		{"", nil},
+		// a.txt was renamed b.txt in c2.
+		{rec("c3", "third") + "\x00\nb.txt\x00" + rec("c2", "second") + "\x00\nb.txt\x00" + rec("c1", "first") + "\x00\na.txt\x00",
+			[]models.FileVersion{v(commit("c3", "third"), "b.txt"), v(commit("c2", "second"), "b.txt"), v(commit("c1", "first"), "a.txt")}},
+		// A merge without a file gets the name of the newer version.
+		{rec("c3", "merge") + "\x00" + rec("c2", "second") + "\x00\nsub/b c.txt\x00",
+			[]models.FileVersion{v(commit("c3", "merge"), "b.txt"), v(commit("c2", "second"), "sub/b c.txt")}},
+	} {
+		if g := parseFileLog(test.out, "b.txt"); fmt.Sprint(g) != fmt.Sprint(test.expected) {
+			t.Errorf("%03d: FAILED %q: got=%v wanted=%v", i, test.out, g, test.expected)
+		}
+	}
+}
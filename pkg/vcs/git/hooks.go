@@ -0,0 +1,119 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/StackExchange/blackbox/v2/pkg/bbutil"
+)
+
+// hookMarker identifies a hook written by blackbox.
+const hookMarker = "# blackbox pre-commit hook."
+
+// hookChained is the name an existing hook is moved to. It is run after
+// the blackbox checks pass.
+const hookChained = "pre-commit.local"
+
+// hooksDir returns the directory git runs hooks from. This honors
+// core.hooksPath and works within worktrees.
+func hooksDir(repobasedir string) (string, error) {
+	out, err := bbutil.RunBashOutput("git", "-C", repobasedir, "rev-parse", "--git-path", "hooks")
+	if err != nil {
+		return "", fmt.Errorf("git can not find the hooks directory: %w", err)
+	}
+	dir := strings.TrimSuffix(out, "\n")
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(repobasedir, dir)
+	}
+	return dir, nil
+}
+
+// hookScript generates a pre-commit hook that runs each command.
+func hookScript(commands []string) string {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n")
+	b.WriteString(hookMarker + " Managed by \"blackbox hooks install\".\n")
+	b.WriteString("# Each line below checks one blackbox config dir. To add another, run\n")
+	b.WriteString("# \"blackbox --team=TEAM hooks install\". Do not edit by hand.\n")
+	for _, c := range commands {
+		b.WriteString(c + " || exit 1\n")
+	}
+	b.WriteString("# Run the hook that was here before blackbox was installed (if any).\n")
+	b.WriteString(`chained="$(dirname "$0")/` + hookChained + `"` + "\n")
+	b.WriteString(`if [ -x "$chained" ]; then exec "$chained" "$@"; fi` + "\n")
+	return b.String()
+}
+
+// hookCommands extracts the commands from a hook written by hookScript.
+func hookCommands(script string) []string {
+	var commands []string
+	for _, line := range strings.Split(script, "\n") {
+		if strings.HasPrefix(line, "blackbox ") {
+			commands = append(commands, strings.TrimSuffix(line, " || exit 1"))
+		}
+	}
+	return commands
+}
+
+// InstallPreCommitHook adds command to the git pre-commit hook.
+// A pre-existing hook that blackbox didn't write is renamed to
+// pre-commit.local and is run after the blackbox checks pass.
+func (v VcsHandle) InstallPreCommitHook(repobasedir string, command string) error {
+	dir, err := hooksDir(repobasedir)
+	if err != nil {
+		return err
+	}
+	if !v.dryRun {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("can not create hooks directory: %w", err)
+		}
+	}
+	hook := filepath.Join(dir, "pre-commit")
+
+	var commands []string
+	old, err := ioutil.ReadFile(hook)
+	switch {
+	case os.IsNotExist(err):
+		// Nothing to preserve.
+	case err != nil:
+		return fmt.Errorf("can not read %q: %w", hook, err)
+	case strings.Contains(string(old), hookMarker):
+		commands = hookCommands(string(old))
+	default:
+		// Someone else's hook. Move it aside so that we can chain to it.
+		chained := filepath.Join(dir, hookChained)
+		if bbutil.FileExistsOrProblem(chained) {
+			return fmt.Errorf("can not install hook: both %q and %q exist", hook, chained)
+		}
+		if v.dryRun {
+			bbutil.DryRunf("would move %q to %q", hook, chained)
+		} else {
+			if err := os.Rename(hook, chained); err != nil {
+				return fmt.Errorf("can not move existing hook aside: %w", err)
+			}
+			fmt.Printf("Existing hook moved to %q. It will be run after blackbox's checks.\n", chained)
+		}
+	}
+
+	for _, c := range commands {
+		if c == command {
+			fmt.Printf("Hook already installed: %q\n", hook)
+			return nil
+		}
+	}
+	commands = append(commands, command)
+
+	if v.dryRun {
+		bbutil.DryRunf("would write %q", hook)
+		return nil
+	}
+	err = ioutil.WriteFile(hook, []byte(hookScript(commands)), 0o755)
+	if err != nil {
+		return fmt.Errorf("can not write %q: %w", hook, err)
+	}
+	fmt.Printf("Hook installed: %q\n", hook)
+	return nil
+}
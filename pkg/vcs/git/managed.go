@@ -0,0 +1,201 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/StackExchange/blackbox/v2/models"
+	"github.com/StackExchange/blackbox/v2/pkg/bbutil"
+)
+
+// The managed block is delimited so that it can be regenerated without
+// disturbing the lines around it. Regenerating it is idempotent.
+const (
+	blockBegin = "# BEGIN %s -- managed by blackbox. Do not edit. Regenerate with: blackbox vcs sync"
+	blockEnd   = "# END %s"
+)
+
+// SetManaged replaces the blackbox block in the .gitignore and
+// .gitattributes files in the base of the repo. Lines outside the
+// block that duplicate it are removed, as are the lines that older
+// versions added to .gitattributes files next to each file.
+func (v VcsHandle) SetManaged(repobasedir string, m models.Managed) error {
+	var ignores []string
+	for _, name := range m.IgnoreAnywhere {
+		ignores = append(ignores, gitSafeFilename(name))
+	}
+	for _, name := range m.Ignore {
+		ignores = append(ignores, "/"+gitSafeFilename(name))
+	}
+
+	// legacy[dir] is the lines older versions wrote in dir/.gitattributes.
+	var attrs []string
+	legacy := map[string]map[string]bool{}
+	for _, a := range m.Attributes {
+		attrs = append(attrs, fmt.Sprintf("%q %s", "/"+globEscape(a.Name), strings.Join(a.Attrs, " ")))
+		d, n := path.Split(a.Name)
+		if legacy[d] == nil {
+			legacy[d] = map[string]bool{}
+		}
+		for _, attr := range a.Attrs {
+			legacy[d][fmt.Sprintf("%q %s", n, attr)] = true
+		}
+	}
+
+	var changed []string
+	add := func(filename string, c bool, err error) error {
+		if c {
+			changed = append(changed, filename)
+		}
+		return err
+	}
+
+	filename := filepath.Join(repobasedir, ".gitignore")
+	c, err := rewriteBlock(filename, m.Block, ignores, nil, v.dryRun)
+	if err = add(filename, c, err); err != nil {
+		return err
+	}
+	filename = filepath.Join(repobasedir, ".gitattributes")
+	c, err = rewriteBlock(filename, m.Block, attrs, legacy[""], v.dryRun)
+	if err = add(filename, c, err); err != nil {
+		return err
+	}
+	var dirs []string
+	for d := range legacy {
+		if d != "" {
+			dirs = append(dirs, d)
+		}
+	}
+	sort.Strings(dirs)
+	for _, d := range dirs {
+		filename = filepath.Join(repobasedir, filepath.FromSlash(d), ".gitattributes")
+		c, err = rewriteBlock(filename, "", nil, legacy[d], v.dryRun)
+		if err = add(filename, c, err); err != nil {
+			return err
+		}
+	}
+
+	if len(changed) != 0 {
+		v.NeedsCommit("update blackbox block in .gitignore and .gitattributes", repobasedir, changed)
+	}
+	return nil
+}
+
+// rewriteBlock replaces the block named block in filename with lines,
+// and removes the lines outside of any block that duplicate lines or
+// are in legacy. If block is "", only the removal is done. Blocks of
+// other names are left alone. A file that ends up empty is deleted.
+// It reports whether filename was changed (or, if dryRun, would have
+// been; the lines that would be added and removed are printed instead).
+func rewriteBlock(filename, block string, lines []string, legacy map[string]bool, dryRun bool) (bool, error) {
+	orig, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		if len(lines) == 0 {
+			return false, nil
+		}
+	} else if err != nil {
+		return false, err
+	}
+
+	dup := map[string]bool{}
+	for _, l := range lines {
+		dup[l] = true
+	}
+	begin, end := fmt.Sprintf(blockBegin, block), fmt.Sprintf(blockEnd, block)
+
+	var out []string
+	at := -1 // Where our block was.
+	ours, others := false, false
+	for _, l := range strings.SplitAfter(string(orig), "\n") {
+		if l == "" {
+			continue // SplitAfter's empty final element.
+		}
+		l = strings.TrimSuffix(l, "\n")
+		switch {
+		case block != "" && l == begin:
+			ours = true
+			at = len(out)
+		case ours:
+			ours = l != end
+		case others:
+			others = !strings.HasPrefix(l, "# END ")
+			out = append(out, l)
+		case strings.HasPrefix(l, "# BEGIN "):
+			others = true
+			out = append(out, l)
+		case dup[l] || legacy[l]:
+			// Drop it.
+		default:
+			out = append(out, l)
+		}
+	}
+
+	if len(lines) != 0 {
+		b := append(append([]string{begin}, lines...), end)
+		if at == -1 {
+			at = len(out)
+			if at != 0 && out[at-1] != "" {
+				b = append([]string{""}, b...)
+			}
+		}
+		out = append(out[:at], append(b, out[at:]...)...)
+	}
+
+	var s string
+	if len(out) != 0 {
+		s = strings.Join(out, "\n") + "\n"
+	}
+	if s == string(orig) {
+		return false, nil
+	}
+	if dryRun {
+		printChanges(filename, string(orig), s)
+		return true, nil
+	}
+	if s == "" {
+		return true, os.Remove(filename)
+	}
+	return true, ioutil.WriteFile(filename, []byte(s), 0o660)
+}
+
+// globEscape escapes the characters that a .gitattributes pattern
+// treats as wildcards.
+func globEscape(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if r == '\\' || r == '*' || r == '?' || r == '[' || r == ']' {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// printChanges prints the lines that changing filename from orig to s
+// would add and remove.
+func printChanges(filename, orig, s string) {
+	count := map[string]int{}
+	for _, l := range strings.Split(orig, "\n") {
+		count[l]++
+	}
+	for _, l := range strings.Split(s, "\n") {
+		count[l]--
+	}
+	for _, l := range strings.Split(orig, "\n") {
+		if count[l] > 0 {
+			count[l]--
+			bbutil.DryRunf("would remove from %q: %s", filename, l)
+		}
+	}
+	for _, l := range strings.Split(s, "\n") {
+		if count[l] < 0 {
+			count[l]++
+			bbutil.DryRunf("would add to %q: %s", filename, l)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRewriteBlock(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "bbmanaged")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// B and E are our block's begin and end, OB and OE another's.
+	B, E := fmt.Sprintf(blockBegin, "blackbox"), fmt.Sprintf(blockEnd, "blackbox")
+	OB, OE := fmt.Sprintf(blockBegin, "other"), fmt.Sprintf(blockEnd, "other")
+	join := func(lines ...string) string {
+		if len(lines) == 0 {
+			return ""
+		}
+		return strings.Join(lines, "\n") + "\n"
+	}
+	legacy := map[string]bool{"/secret.txt": true}
+
+	for i, test := range []struct {
+		desc     string
+		orig     string // "" means the file is missing.
+		block    string
+		lines    []string
+		expected string // "" means the file should not exist.
+		changed  bool
+	}{
+		{"create", "", "blackbox", []string{"/a", "/b"},
+			join(B, "/a", "/b", E), true},
+		{"missing, nothing to add", "", "blackbox", nil,
+			"", false},
+		{"append", join("*.o"), "blackbox", []string{"/a"},
+			join("*.o", "", B, "/a", E), true},
+		{"replace in place", join("*.o", B, "/old", E, "*.tmp"), "blackbox", []string{"/a", "/b"},
+			join("*.o", B, "/a", "/b", E, "*.tmp"), true},
+		{"unchanged", join("*.o", B, "/a", E), "blackbox", []string{"/a"},
+			join("*.o", B, "/a", E), false},
+		{"legacy lines removed", join("/secret.txt", "*.o"), "blackbox", []string{"/a"},
+			join("*.o", "", B, "/a", E), true},
+		{"duplicates removed", join("/a", "*.o"), "blackbox", []string{"/a"},
+			join("*.o", "", B, "/a", E), true},
+		{"legacy only", join("/secret.txt", "*.o"), "", nil,
+			join("*.o"), true},
+		{"other blocks left alone", join(OB, "/a", "/secret.txt", OE), "blackbox", []string{"/a"},
+			join(OB, "/a", "/secret.txt", OE, "", B, "/a", E), true},
+		{"other block with our block", join(OB, "/x", OE, B, "/old", E), "blackbox", []string{"/a"},
+			join(OB, "/x", OE, B, "/a", E), true},
+		{"delete when empty", join(B, "/a", E), "blackbox", nil,
+			"", true},
+		{"delete when only legacy", join("/secret.txt"), "", nil,
+			"", true},
+		{"keep the rest when emptied", join("*.o", B, "/a", E), "blackbox", nil,
+			join("*.o"), true},
+	} {
+		fn := filepath.Join(tmp, ".gitignore")
+		os.Remove(fn)
+		if test.orig != "" {
+			if err := ioutil.WriteFile(fn, []byte(test.orig), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		changed, err := rewriteBlock(fn, test.block, test.lines, legacy, false)
+		if err != nil {
+			t.Errorf("%03d: FAILED %s: %v", i, test.desc, err)
+			continue
+		}
+		g, err := ioutil.ReadFile(fn)
+		if os.IsNotExist(err) {
+			g = nil
+		} else if err != nil {
+			t.Fatal(err)
+		} else if test.expected == "" {
+			t.Errorf("%03d: FAILED %s: file exists: %q", i, test.desc, g)
+			continue
+		}
+		if string(g) != test.expected {
+			t.Errorf("%03d: FAILED %s: got=%q wanted=%q", i, test.desc, g, test.expected)
+		}
+		if changed != test.changed {
+			t.Errorf("%03d: FAILED %s: changed=%v wanted=%v", i, test.desc, changed, test.changed)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/StackExchange/blackbox/v2/pkg/bbutil"
+)
+
+// NestedRepos lists the checked-out submodules, the repos within the
+// repo's directory tree, and the repo's other worktrees. The paths are
+// relative to repobasedir (worktrees may be outside of it).
+func (v VcsHandle) NestedRepos(repobasedir string) ([]string, error) {
+	var repos []string
+
+	// Submodules are "gitlinks" (mode 160000) in the index.
+	out, err := bbutil.RunBashOutput("git", "-C", repobasedir, "ls-files", "-z", "--stage")
+	if err != nil {
+		return nil, fmt.Errorf("git can not list submodules: %w", err)
+	}
+	for _, dir := range parseGitlinks(out) {
+		repos = appendIfRepo(repos, repobasedir, dir)
+	}
+
+	// Git doesn't descend into other repos, so they are listed as
+	// untracked (or ignored) directories.
+	out, err = bbutil.RunBashOutput("git", "-C", repobasedir, "ls-files", "-z", "--others", "--directory")
+	if err != nil {
+		return nil, fmt.Errorf("git can not list untracked directories: %w", err)
+	}
+	for _, dir := range parseDirs(out) {
+		repos = appendIfRepo(repos, repobasedir, dir)
+	}
+
+	// Worktrees. The first is the main worktree, which may be this one.
+	out, err = bbutil.RunBashOutput("git", "-C", repobasedir, "worktree", "list", "--porcelain")
+	if err != nil {
+		return nil, fmt.Errorf("git can not list worktrees: %w", err)
+	}
+	base, err := filepath.Abs(repobasedir)
+	if err != nil {
+		return nil, err
+	}
+	for _, wt := range parseWorktrees(out) {
+		if wt == base {
+			continue
+		}
+		rel, err := filepath.Rel(base, wt)
+		if err != nil {
+			rel = wt
+		}
+		repos = appendIfRepo(repos, repobasedir, rel)
+	}
+
+	return repos, nil
+}
+
+// appendIfRepo appends dir to repos if it is the root of a checkout
+// (i.e. it has a .git file or directory).
+func appendIfRepo(repos []string, repobasedir, dir string) []string {
+	if _, err := os.Stat(filepath.Join(repobasedir, dir, ".git")); err != nil {
+		return repos
+	}
+	return append(repos, filepath.FromSlash(dir))
+}
+
+// parseGitlinks returns the paths of the submodules in the output of
+// git ls-files -z --stage.
+func parseGitlinks(out string) []string {
+	var dirs []string
+	for _, rec := range strings.Split(out, "\x00") {
+		// Format: "<mode> SP <object> SP <stage> TAB <file>"
+		tab := strings.IndexByte(rec, '\t')
+		if tab == -1 || !strings.HasPrefix(rec, "160000 ") {
+			continue
+		}
+		dirs = append(dirs, rec[tab+1:])
+	}
+	return dirs
+}
+
+// parseDirs returns the directories (without the trailing "/") in the
+// output of git ls-files -z --others --directory.
+func parseDirs(out string) []string {
+	var dirs []string
+	for _, rec := range strings.Split(out, "\x00") {
+		if strings.HasSuffix(rec, "/") {
+			dirs = append(dirs, strings.TrimSuffix(rec, "/"))
+		}
+	}
+	return dirs
+}
+
+// parseWorktrees returns the paths of the worktrees in the output of
+// git worktree list --porcelain.
+func parseWorktrees(out string) []string {
+	var wts []string
+	for _, line := range strings.Split(out, "\n") {
+		if wt := strings.TrimPrefix(line, "worktree "); wt != line {
+			wts = append(wts, wt)
+		}
+	}
+	return wts
+}
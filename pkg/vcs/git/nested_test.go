@@ -0,0 +1,52 @@
+package git
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseGitlinks(t *testing.T) {
+	for i, test := range []struct {
+		out      string
+		expected []string
+	}{
+		{"", nil},
+		{"100644 0f7b 0\ta.txt\x00160000 9a9a 0\tvendor/sub\x00100644 c1b0 0\tz.txt\x00", []string{"vendor/sub"}},
+		{"160000 9a9a 0\tsub one\x00160000 8b8b 0\tsub\ttwo\x00", []string{"sub one", "sub\ttwo"}},
+		{"100644 0f7b 0\t160000 x\x00", nil},
+	} {
+		if g := parseGitlinks(test.out); fmt.Sprintf("%q", g) != fmt.Sprintf("%q", test.expected) {
+			t.Errorf("%03d: FAILED %q: got=%q wanted=%q", i, test.out, g, test.expected)
+		}
+	}
+}
+
+func TestParseDirs(t *testing.T) {
+	for i, test := range []struct {
+		out      string
+		expected []string
+	}{
+		{"", nil},
+		{"new.txt\x00other/\x00a/b c/\x00", []string{"other", "a/b c"}},
+	} {
+		if g := parseDirs(test.out); fmt.Sprintf("%q", g) != fmt.Sprintf("%q", test.expected) {
+			t.Errorf("%03d: FAILED %q: got=%q wanted=%q", i, test.out, g, test.expected)
+		}
+	}
+}
+
+func TestParseWorktrees(t *testing.T) {
+	for i, test := range []struct {
+		out      string
+		expected []string
+	}{
+		{"", nil},
+		{"worktree /src/repo\nHEAD 60a1\nbranch refs/heads/main\n\n", []string{"/src/repo"}},
+		{"worktree /src/repo\nHEAD 60a1\nbranch refs/heads/main\n\nworktree /src/repo wt\nHEAD 60a1\ndetached\n\nworktree /tmp/x\nbare\n\n",
+			[]string{"/src/repo", "/src/repo wt", "/tmp/x"}},
+	} {
+		if g := parseWorktrees(test.out); fmt.Sprintf("%q", g) != fmt.Sprintf("%q", test.expected) {
+			t.Errorf("%03d: FAILED %q: got=%q wanted=%q", i, test.out, g, test.expected)
+		}
+	}
+}
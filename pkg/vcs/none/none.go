@@ -2,7 +2,11 @@ package none
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 
+	"github.com/StackExchange/blackbox/v2/models"
+	"github.com/StackExchange/blackbox/v2/pkg/bbutil"
 	"github.com/StackExchange/blackbox/v2/pkg/commitlater"
 	"github.com/StackExchange/blackbox/v2/pkg/vcs"
 )
@@ -16,6 +20,7 @@ func init() {
 // VcsHandle is
 type VcsHandle struct {
 	repoRoot string
+	dryRun   bool // Only say what would be changed.
 }
 
 func newNone() (vcs.Vcs, error) {
@@ -27,9 +32,33 @@ func (v VcsHandle) Name() string {
 	return pluginName
 }
 
+// SetDryRun makes the methods that would change files only say what
+// they would do.
+func (v *VcsHandle) SetDryRun(dryRun bool) {
+	v.dryRun = dryRun
+}
+
+// markerFile marks the base of a repo-less tree (i.e. /etc managed by
+// config management). File names are relative to the directory it is in.
+const markerFile = ".blackbox_config"
+
 // Discover returns true if we are a repo of this type; along with the Abs path to the repo root (or "" if we don't know).
+// Without a VCS the root is the nearest directory (searching upwards from the cwd) that has a .blackbox_config file.
 func (v VcsHandle) Discover() (bool, string) {
-	return true, "" // We don't know the root.
+	dir, err := os.Getwd()
+	if err != nil {
+		return true, ""
+	}
+	for {
+		if _, err := os.Lstat(filepath.Join(dir, markerFile)); err == nil {
+			return true, dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return true, "" // We don't know the root.
+		}
+		dir = parent
+	}
 }
 
 //// SetRepoRoot informs the Vcs of the VCS root.
@@ -37,21 +66,115 @@ func (v VcsHandle) Discover() (bool, string) {
 //	v.repoRoot = dir
 //}
 
-// SetFileTypeUnix informs the VCS that files should maintain unix-style line endings.
-func (v VcsHandle) SetFileTypeUnix(repobasedir string, files ...string) error {
+// SetManaged replaces the ignores and attributes that blackbox maintains. Without a VCS there are none.
+func (v VcsHandle) SetManaged(repobasedir string, m models.Managed) error {
+	return nil
+}
+
+// SetDiffDriver defines a driver that displays diffs of files using the text command outputs.
+func (v VcsHandle) SetDiffDriver(repobasedir string, driver string, command string) error {
+	return nil
+}
+
+// SetMergeDriver defines a driver that merges files using command.
+func (v VcsHandle) SetMergeDriver(repobasedir string, driver string, command string) error {
 	return nil
 }
 
-// IgnoreAnywhere tells the VCS to ignore these files anywhere in the repo.
-func (v VcsHandle) IgnoreAnywhere(repobasedir string, files []string) error {
+// SetFilterDriver defines a driver that runs files through clean and smudge commands.
+func (v VcsHandle) SetFilterDriver(repobasedir string, driver string, clean string, smudge string) error {
+	return fmt.Errorf("no VCS, no filters")
+}
+
+// Remove deletes files.
+func (v VcsHandle) Remove(repobasedir string, names []string) error {
+	for _, name := range names {
+		if v.dryRun {
+			bbutil.DryRunf("would remove %q", filepath.Join(repobasedir, name))
+			continue
+		}
+		err := os.Remove(filepath.Join(repobasedir, name))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
 	return nil
 }
 
-// IgnoreFiles tells the VCS to ignore these files anywhere in the repo.
-func (v VcsHandle) IgnoreFiles(repobasedir string, files []string) error {
+// Rename moves a file.
+func (v VcsHandle) Rename(repobasedir string, oldname, newname string) error {
+	newname = filepath.Join(repobasedir, newname)
+	if v.dryRun {
+		bbutil.DryRunf("would move %q to %q", filepath.Join(repobasedir, oldname), newname)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(newname), 0o750); err != nil {
+		return err
+	}
+	return os.Rename(filepath.Join(repobasedir, oldname), newname)
+}
+
+// NestedRepos lists the repos nested in this one. Without a VCS there are none.
+func (v VcsHandle) NestedRepos(repobasedir string) ([]string, error) {
+	return nil, nil
+}
+
+// FileHistory reports whether the VCS tracks a file and lists the commits that touched it.
+func (v VcsHandle) FileHistory(repobasedir string, name string) (bool, []string, error) {
+	return false, nil, nil
+}
+
+// TrackedFiles lists the files that the VCS tracks. Without a VCS there are none.
+func (v VcsHandle) TrackedFiles(repobasedir string) ([]string, error) {
+	return nil, nil
+}
+
+// NeedsUntrack queues up telling the VCS to stop tracking files.
+func (v VcsHandle) NeedsUntrack(message string, repobasedir string, names []string) {
+	return
+}
+
+// Ignored returns the names that the VCS ignores. Without a VCS nothing
+// is committed, which is as good as all of them.
+func (v VcsHandle) Ignored(repobasedir string, names []string) ([]string, error) {
+	return names, nil
+}
+
+// WalkHistory calls fn for every commit. There are none.
+func (v VcsHandle) WalkHistory(repobasedir string, fn func(c models.Commit, files []models.TreeEntry) error) error {
 	return nil
 }
 
+// HashContent returns the hash the VCS would give a file containing data.
+func (v VcsHandle) HashContent(repobasedir string, data []byte) (string, error) {
+	return "", fmt.Errorf("no VCS, no hashes")
+}
+
+// FileLog lists the commits that changed a file. There are none.
+func (v VcsHandle) FileLog(repobasedir string, name string) ([]models.FileVersion, error) {
+	return nil, fmt.Errorf("no VCS, no history")
+}
+
+// CatRevision returns the contents of a file as of a revision.
+func (v VcsHandle) CatRevision(repobasedir string, rev string, name string) ([]byte, error) {
+	return nil, fmt.Errorf("no VCS, no revisions")
+}
+
+// StagedFiles lists the files that will be added or changed by the next commit.
+func (v VcsHandle) StagedFiles(repobasedir string) ([]string, error) {
+	return nil, nil
+}
+
+// CatStaged returns the contents of a file as it will be committed.
+func (v VcsHandle) CatStaged(repobasedir string, name string) ([]byte, error) {
+	return nil, fmt.Errorf("no VCS, nothing is staged")
+}
+
+// InstallPreCommitHook adds command to the VCS's pre-commit hook.
+func (v VcsHandle) InstallPreCommitHook(repobasedir string, command string) error {
+	return fmt.Errorf("no VCS, no hooks to install")
+}
+
 // CommitTitle sets the title of the next commit.
 func (v VcsHandle) CommitTitle(title string) {}
 
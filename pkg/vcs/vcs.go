@@ -29,15 +29,23 @@ type Item struct {
 var Catalog []*Item
 
 // Discover polls the VCS plug-ins to determine the VCS of directory.
-// The first to succeed is returned.
-// It never returns nil, since "NONE" is always valid.
-func Discover() (Vcs, string) {
+// The first to succeed is returned. If name is not "", only the plug-in
+// of that name is polled (i.e. to force "NONE").
+// It never returns nil, since "NONE" is always valid, unless name is
+// not a plug-in. The repo root is "" if the plug-in doesn't know it.
+func Discover(name string) (Vcs, string) {
 	for _, v := range Catalog {
+		if name != "" && !strings.EqualFold(v.Name, name) {
+			continue
+		}
 		h, err := v.New()
 		if err != nil {
 			return nil, "" // No idea how that would happen.
 		}
 		if b, repodir := h.Discover(); b {
+			if repodir == "" {
+				return h, ""
+			}
 
 			// Try to find the rel path from CWD to RepoBase
 			wd, err := os.Getwd()
@@ -63,10 +71,20 @@ func Discover() (Vcs, string) {
 			return h, r
 		}
 	}
-	// This can't happen. If it does, we'll panic and that's ok.
+	// This can't happen (unless name is wrong). If it does, we'll panic and that's ok.
 	return nil, ""
 }
 
+// New returns a new handle for the VCS plug-in named name.
+func New(name string) (Vcs, error) {
+	for _, v := range Catalog {
+		if strings.EqualFold(v.Name, name) {
+			return v.New()
+		}
+	}
+	return nil, fmt.Errorf("no VCS named %q", name)
+}
+
 // Register a new VCS.
 func Register(name string, priority int, newfn NewFnSig) {
 	//fmt.Printf("VCS registered: %v\n", name)